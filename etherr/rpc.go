@@ -1,6 +1,9 @@
 package etherr
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type RpcError struct {
 	err     string
@@ -18,6 +21,31 @@ var Nil = New("Result is null", 0, "")
 // ConnectionClosed is returned when the websocket connection is closed
 var ConnectionClosed = New("Websocket connection closed", 0, "")
 
+// ConnectionLost is the error of the requests and subscriptions ended by a connection
+// that died, with the cause in its details
+func ConnectionLost(cause error) error {
+	return New("Connection lost", 0, cause.Error())
+}
+
+// IsConnectionLoss tells if err is the end of a connection: closed, lost or killed as
+// stalled, rather than an error of the node
+func IsConnectionLoss(err error) bool {
+	if err == ConnectionClosed || err == SubscriptionStalled {
+		return true
+	}
+	e, ok := err.(*RpcError)
+	return ok && e.err == "Connection lost"
+}
+
+// RequestTimeout is returned when the node did not answer a request in time
+var RequestTimeout = New("Request timed out", 0, "")
+
+// SubscriptionOverflow ends the subscriptions whose consumer fell too far behind
+var SubscriptionOverflow = New("Subscription receiver overflow", 0, "")
+
+// SubscriptionStalled kills the connections whose subscriptions got no notification for too long
+var SubscriptionStalled = New("Subscription stalled", 0, "")
+
 // Empty is returned when a rpc call returned an empty result
 var Empty = New("Result is empty", 0, "")
 
@@ -27,6 +55,12 @@ var InvalidUInt8 = New("Result is not a valid uint8", 0, "")
 // VMExecutionError parity returns this when there was an error executing the call in the VM
 var VMExecutionError = New("VM execution error", 0, "")
 
+// MissingResponse is returned for the requests of a batch the node did not answer
+var MissingResponse = New("No response in batch", 0, "")
+
+// DuplicateResponse is returned for the requests of a batch the node answered more than once
+var DuplicateResponse = New("Duplicate response in batch", 0, "")
+
 // New returns a new rpcError
 func New(err string, code int, details string) error {
 	return &RpcError{
@@ -35,3 +69,21 @@ func New(err string, code int, details string) error {
 		Details: details,
 	}
 }
+
+// HTTPError is returned when the node answers with a non successful http status, unless
+// the body is a json rpc error: that error is returned instead
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	// RetryAfter is the delay requested by the server through the Retry-After header, if any
+	RetryAfter time.Duration
+	Body       []byte
+}
+
+func (e *HTTPError) Error() string {
+	body := e.Body
+	if len(body) > 256 {
+		body = body[:256]
+	}
+	return fmt.Sprintf("http status %s: %s", e.Status, body)
+}
@@ -0,0 +1,208 @@
+package ethrpc
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/strhelper"
+	"github.com/alethio/web3-go/types"
+)
+
+// errNotExecuted is returned by the results of a batch that was not executed yet
+var errNotExecuted = fmt.Errorf("batch not executed")
+
+// Batch queues calls to send them in a single round trip. Providers which can not
+// batch, like http without batch support, make the calls one after the other.
+type Batch struct {
+	rpc      provider.Interface
+	elems    []*provider.BatchElem
+	executed bool
+}
+
+// BatchCall is a call queued in a batch, its result is available once the batch was executed
+type BatchCall struct {
+	b    *Batch
+	elem *provider.BatchElem
+}
+
+// Err returns the error of the call
+func (c *BatchCall) Err() error {
+	if !c.b.executed {
+		return errNotExecuted
+	}
+	return c.elem.Error
+}
+
+// BlockCall is a queued call returning a block
+type BlockCall struct {
+	BatchCall
+	block types.Block
+}
+
+// Result returns the block and the error of the call
+func (c *BlockCall) Result() (types.Block, error) {
+	return c.block, c.Err()
+}
+
+// TransactionCall is a queued call returning a transaction
+type TransactionCall struct {
+	BatchCall
+	tx types.Transaction
+}
+
+// Result returns the transaction and the error of the call
+func (c *TransactionCall) Result() (types.Transaction, error) {
+	// geth correction, see ETH.GetTransactionByHash
+	if c.tx.BlockNumber == "" && c.tx.BlockHash == "0x0000000000000000000000000000000000000000000000000000000000000000" {
+		c.tx.BlockHash = ""
+	}
+	return c.tx, c.Err()
+}
+
+// ReceiptCall is a queued call returning a transaction receipt
+type ReceiptCall struct {
+	BatchCall
+	receipt types.Receipt
+}
+
+// Result returns the receipt and the error of the call
+func (c *ReceiptCall) Result() (types.Receipt, error) {
+	return c.receipt, c.Err()
+}
+
+// TracesCall is a queued call returning the traces of a block
+type TracesCall struct {
+	BatchCall
+	traces []types.Trace
+}
+
+// Result returns the traces and the error of the call
+func (c *TracesCall) Result() ([]types.Trace, error) {
+	return c.traces, c.Err()
+}
+
+// QuantityCall is a queued call returning a hex encoded quantity
+type QuantityCall struct {
+	BatchCall
+	raw string
+}
+
+// Raw returns the quantity as a hex string
+func (c *QuantityCall) Raw() (string, error) {
+	if err := c.Err(); err != nil {
+		return "", err
+	}
+	if c.raw == "0x" || c.raw == "" {
+		return "", etherr.Empty
+	}
+	return c.raw, nil
+}
+
+// Int64 returns the quantity as an int64
+func (c *QuantityCall) Int64() (int64, error) {
+	raw, err := c.Raw()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(raw, 0, 64)
+}
+
+// BigInt returns the quantity as a big.Int
+func (c *QuantityCall) BigInt() (*big.Int, error) {
+	raw, err := c.Raw()
+	if err != nil {
+		return nil, err
+	}
+	return strhelper.HexStrToBigInt(raw)
+}
+
+// NewBatch creates an empty batch on the provider of e
+func (e *ETH) NewBatch() *Batch {
+	return &Batch{rpc: e.rpc}
+}
+
+// Len returns the number of queued calls
+func (b *Batch) Len() int {
+	return len(b.elems)
+}
+
+// Execute sends the queued calls. The error is about the batch as a whole,
+// every call has its own error as well.
+func (b *Batch) Execute() error {
+	if b.executed {
+		return fmt.Errorf("batch already executed")
+	}
+	b.executed = true
+	return provider.CallBatch(b.rpc, b.elems)
+}
+
+func (b *Batch) queue(result interface{}, method string, params ...interface{}) BatchCall {
+	elem := &provider.BatchElem{Method: method, Params: params, Result: result}
+	b.elems = append(b.elems, elem)
+	return BatchCall{b: b, elem: elem}
+}
+
+// MakeRequest queues a call decoding its result into result, see ETH.MakeRequest
+func (b *Batch) MakeRequest(result interface{}, method string, params ...interface{}) *BatchCall {
+	c := b.queue(result, method, params...)
+	return &c
+}
+
+// GetBlockByNumber queues the retrieval of a block with full transaction array
+func (b *Batch) GetBlockByNumber(number string) *BlockCall {
+	c := &BlockCall{}
+	c.BatchCall = b.queue(&c.block, ETHGetBlockByNumber, number, true)
+	return c
+}
+
+// GetUncleByBlockNumberAndIndex queues the retrieval of the index-nth uncle of a block
+func (b *Batch) GetUncleByBlockNumberAndIndex(blockNumber string, index string) *BlockCall {
+	c := &BlockCall{}
+	c.BatchCall = b.queue(&c.block, ETHGetUncleByBlockNumberAndIndex, blockNumber, index)
+	return c
+}
+
+// GetTransactionByHash queues the retrieval of a transaction
+func (b *Batch) GetTransactionByHash(hash string) *TransactionCall {
+	c := &TransactionCall{}
+	c.BatchCall = b.queue(&c.tx, ETHGetTransactionByHash, hash)
+	return c
+}
+
+// GetTransactionReceipt queues the retrieval of a transaction receipt
+func (b *Batch) GetTransactionReceipt(hash string) *ReceiptCall {
+	c := &ReceiptCall{}
+	c.BatchCall = b.queue(&c.receipt, ETHGetTransactionReceipt, hash)
+	return c
+}
+
+// GetBalanceAtBlock queues the retrieval of the balance of an address
+func (b *Batch) GetBalanceAtBlock(address, blockNumber string) *QuantityCall {
+	c := &QuantityCall{}
+	c.BatchCall = b.queue(&c.raw, ETHGetBalance, address, blockNumber)
+	return c
+}
+
+// GetBlockTransactionCountByNumber queues the retrieval of the transaction count of a block
+func (b *Batch) GetBlockTransactionCountByNumber(number string) *QuantityCall {
+	c := &QuantityCall{}
+	c.BatchCall = b.queue(&c.raw, ETHGetBlockTransactionCountByNumber, number)
+	return c
+}
+
+// GetBlockNumber queues the retrieval of the latest block number
+func (b *Batch) GetBlockNumber() *QuantityCall {
+	c := &QuantityCall{}
+	c.BatchCall = b.queue(&c.raw, ETHBlockNumber)
+	return c
+}
+
+// TraceBlock queues the retrieval of the traces of a block
+func (b *Batch) TraceBlock(blockNumber string) *TracesCall {
+	c := &TracesCall{}
+	c.BatchCall = b.queue(&c.traces, TraceBlock, blockNumber)
+	return c
+}
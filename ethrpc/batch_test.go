@@ -0,0 +1,187 @@
+package ethrpc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/ethrpc/provider/ipcrpc"
+	"github.com/alethio/web3-go/ethrpc/provider/ratelimit"
+	"github.com/alethio/web3-go/ethrpc/provider/retry"
+	"github.com/alethio/web3-go/ethrpc/provider/wsrpc"
+	"github.com/alethio/web3-go/rpctest"
+)
+
+func testBatch(t *testing.T, eth *ETH) {
+	b := eth.NewBatch()
+	number := b.GetBlockNumber()
+	block := b.GetBlockByNumber("0x10")
+	receipt := b.GetTransactionReceipt("0xdead")
+	balance := b.GetBalanceAtBlock("0xa94f5374fce5edbc8e2a8697c15331677e6ebf0b", "latest")
+	assert.Equal(t, 4, b.Len())
+
+	_, err := number.Int64()
+	assert.Error(t, err, "results are not available before execution")
+
+	assert.NoError(t, b.Execute())
+
+	n, err := number.Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(16), n)
+
+	blk, err := block.Result()
+	assert.NoError(t, err)
+	assert.Equal(t, "0x10", blk.Number)
+
+	_, err = receipt.Result()
+	assert.Equal(t, etherr.Nil, err)
+
+	_, err = balance.BigInt()
+	assert.Error(t, err)
+
+	assert.Error(t, b.Execute(), "a batch is executed once")
+}
+
+// testBatchErrors checks that batches which are not fully answered fail instead of
+// waiting for responses that never come
+func testBatchErrors(t *testing.T, srv *rpctest.Server, eth *ETH) {
+	execute := func(b *Batch) error {
+		done := make(chan error, 1)
+		go func() { done <- b.Execute() }()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(3 * time.Second):
+			t.Fatal("batch still waiting")
+			return nil
+		}
+	}
+
+	// the node rejects the batch as a whole with an error without id
+	srv.RejectBatches(-32600, "batch too large")
+	b := eth.NewBatch()
+	number := b.GetBlockNumber()
+	block := b.GetBlockByNumber("0x10")
+	err := execute(b)
+	if assert.IsType(t, &etherr.RpcError{}, err) {
+		assert.Equal(t, -32600, err.(*etherr.RpcError).Code)
+	}
+	_, err = number.Int64()
+	assert.Error(t, err)
+	_, err = block.Result()
+	assert.Error(t, err)
+	srv.RejectBatches(0, "")
+
+	// the node leaves requests out of its answer
+	srv.TruncateBatches(1)
+	b = eth.NewBatch()
+	number = b.GetBlockNumber()
+	block = b.GetBlockByNumber("0x10")
+	assert.NoError(t, execute(b))
+	n, err := number.Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(16), n)
+	_, err = block.Result()
+	assert.Equal(t, etherr.MissingResponse, err)
+	srv.TruncateBatches(0)
+
+	// the connection is still usable
+	assert.NoError(t, execute(eth.NewBatch()))
+	_, err = eth.GetBlockNumber()
+	assert.NoError(t, err)
+}
+
+func newBatchServer() *rpctest.Server {
+	srv := rpctest.NewServer()
+	srv.Handle(ETHBlockNumber, "0x10")
+	srv.Handle(ETHGetBlockByNumber, map[string]interface{}{"number": "0x10", "transactions": []string{}})
+	srv.Handle(ETHGetTransactionReceipt, nil)
+	// answers come back in any order, they are matched by id
+	srv.ReverseBatches(true)
+	return srv
+}
+
+func TestBatch_HTTP(t *testing.T) {
+	srv := newBatchServer()
+	defer srv.Close()
+
+	p, err := httprpc.New(srv.URL)
+	assert.NoError(t, err)
+	eth, err := New(p)
+	assert.NoError(t, err)
+
+	testBatch(t, eth)
+	testBatchErrors(t, srv, eth)
+}
+
+func TestBatch_WS(t *testing.T) {
+	srv := newBatchServer()
+	defer srv.Close()
+
+	p, err := wsrpc.New(srv.WSURL, false)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+	eth, err := New(p)
+	assert.NoError(t, err)
+
+	testBatch(t, eth)
+	testBatchErrors(t, srv, eth)
+}
+
+func TestBatch_IPC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethrpc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	srv := newBatchServer()
+	defer srv.Close()
+	path := filepath.Join(dir, "geth.ipc")
+	assert.NoError(t, srv.ListenUnix(path))
+
+	p, err := ipcrpc.New(path)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+	eth, err := New(p)
+	assert.NoError(t, err)
+
+	testBatch(t, eth)
+	testBatchErrors(t, srv, eth)
+}
+
+func TestBatch_Interceptors(t *testing.T) {
+	srv := newBatchServer()
+	defer srv.Close()
+
+	h, err := httprpc.New(srv.URL)
+	assert.NoError(t, err)
+	limiter, err := ratelimit.New(0, 0, 1)
+	assert.NoError(t, err)
+	p := retry.NewWithDefaults(ratelimit.Wrap(h, limiter))
+
+	// every call goes through the interceptors, the provider still gets a single batch
+	var mu sync.Mutex
+	var seen []string
+	eth, err := New(p, func(next provider.Handler) provider.Handler {
+		return func(req *provider.Request) ([]byte, error) {
+			mu.Lock()
+			seen = append(seen, req.Method)
+			mu.Unlock()
+			return next(req)
+		}
+	})
+	assert.NoError(t, err)
+
+	testBatch(t, eth)
+	assert.Len(t, srv.Headers(), 1)
+	assert.ElementsMatch(t, []string{ETHBlockNumber, ETHGetBlockByNumber, ETHGetTransactionReceipt, ETHGetBalance}, seen)
+}
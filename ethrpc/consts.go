@@ -7,7 +7,8 @@ const (
 	ParityPendingTransactions = "parity_pendingTransactions"
 
 	// geth
-	GETHTxPoolContent = "txpool_content"
+	GETHTxPoolContent         = "txpool_content"
+	GETHDebugTraceTransaction = "debug_traceTransaction"
 
 	// net
 	NetPeerCount = "net_peerCount"
@@ -0,0 +1,139 @@
+// Package engine is a client of the engine api of the execution clients, served on
+// their jwt authenticated port
+package engine
+
+import (
+	"github.com/alethio/web3-go/ethrpc"
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/ethrpc/provider/wsrpc"
+	"github.com/alethio/web3-go/types"
+)
+
+// json rpc methods
+const (
+	ExchangeCapabilities = "engine_exchangeCapabilities"
+	NewPayloadV1         = "engine_newPayloadV1"
+	NewPayloadV2         = "engine_newPayloadV2"
+	NewPayloadV3         = "engine_newPayloadV3"
+	ForkchoiceUpdatedV1  = "engine_forkchoiceUpdatedV1"
+	ForkchoiceUpdatedV2  = "engine_forkchoiceUpdatedV2"
+	ForkchoiceUpdatedV3  = "engine_forkchoiceUpdatedV3"
+	GetPayloadV1         = "engine_getPayloadV1"
+	GetPayloadV2         = "engine_getPayloadV2"
+	GetPayloadV3         = "engine_getPayloadV3"
+)
+
+// Engine talks to the engine api of an execution client
+type Engine struct {
+	rpc provider.Interface
+}
+
+// New creates an engine client on a provider, authentication is left to the provider
+func New(p provider.Interface) *Engine {
+	return &Engine{rpc: p}
+}
+
+// NewWithDefaults creates an engine client on the http or websocket url of the authenticated
+// port, signing its tokens with the secret of the hex file at secretPath. The ipc socket,
+// which needs no token, is taken too.
+func NewWithDefaults(url, secretPath string) (*Engine, error) {
+	secret, err := LoadSecret(secretPath)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := HeaderFunc(secret)
+	p, err := ethrpc.NewProvider(url,
+		ethrpc.WithHTTPOptions(httprpc.WithHeaderFunc(headers)),
+		ethrpc.WithWSOptions(wsrpc.WithHeaderFunc(headers)))
+	if err != nil {
+		return nil, err
+	}
+	e := New(p)
+	return e, e.Start()
+}
+
+// Start starts the provider
+func (e *Engine) Start() error {
+	return e.rpc.Start()
+}
+
+// Stop stops the provider
+func (e *Engine) Stop() {
+	e.rpc.Stop()
+}
+
+// ExchangeCapabilities sends the engine methods supported by the consensus client and
+// returns the ones supported by the execution client
+func (e *Engine) ExchangeCapabilities(methods []string) (supported []string, err error) {
+	err = e.rpc.Call(&supported, ExchangeCapabilities, methods)
+	return
+}
+
+// NewPayloadV1 hands a paris payload to the execution client for validation
+func (e *Engine) NewPayloadV1(payload types.ExecutionPayload) (s types.PayloadStatus, err error) {
+	err = e.rpc.Call(&s, NewPayloadV1, payload)
+	return
+}
+
+// NewPayloadV2 hands a paris or shanghai payload to the execution client for validation
+func (e *Engine) NewPayloadV2(payload types.ExecutionPayload) (s types.PayloadStatus, err error) {
+	err = e.rpc.Call(&s, NewPayloadV2, payload)
+	return
+}
+
+// NewPayloadV3 hands a cancun payload to the execution client for validation, with the
+// versioned hashes of its blobs and the root of the parent beacon block
+func (e *Engine) NewPayloadV3(payload types.ExecutionPayload, versionedHashes []string, parentBeaconBlockRoot string) (s types.PayloadStatus, err error) {
+	if versionedHashes == nil {
+		versionedHashes = []string{}
+	}
+	if payload.Withdrawals == nil {
+		payload.Withdrawals = []types.Withdrawal{}
+	}
+	err = e.rpc.Call(&s, NewPayloadV3, payload, versionedHashes, parentBeaconBlockRoot)
+	return
+}
+
+// ForkchoiceUpdatedV1 updates the fork choice, a payload is built on the new head when
+// attributes are given
+func (e *Engine) ForkchoiceUpdatedV1(state types.ForkchoiceState, attributes *types.PayloadAttributes) (r types.ForkchoiceUpdatedResponse, err error) {
+	err = e.rpc.Call(&r, ForkchoiceUpdatedV1, state, attributes)
+	return
+}
+
+// ForkchoiceUpdatedV2 is ForkchoiceUpdatedV1 with withdrawals in the attributes
+func (e *Engine) ForkchoiceUpdatedV2(state types.ForkchoiceState, attributes *types.PayloadAttributes) (r types.ForkchoiceUpdatedResponse, err error) {
+	err = e.rpc.Call(&r, ForkchoiceUpdatedV2, state, attributes)
+	return
+}
+
+// ForkchoiceUpdatedV3 is ForkchoiceUpdatedV2 with the parent beacon block root in the attributes
+func (e *Engine) ForkchoiceUpdatedV3(state types.ForkchoiceState, attributes *types.PayloadAttributes) (r types.ForkchoiceUpdatedResponse, err error) {
+	if attributes != nil && attributes.Withdrawals == nil {
+		a := *attributes
+		a.Withdrawals = []types.Withdrawal{}
+		attributes = &a
+	}
+	err = e.rpc.Call(&r, ForkchoiceUpdatedV3, state, attributes)
+	return
+}
+
+// GetPayloadV1 returns the payload built for the id returned by ForkchoiceUpdatedV1
+func (e *Engine) GetPayloadV1(payloadID string) (p types.ExecutionPayload, err error) {
+	err = e.rpc.Call(&p, GetPayloadV1, payloadID)
+	return
+}
+
+// GetPayloadV2 returns the payload built for payloadID with its value
+func (e *Engine) GetPayloadV2(payloadID string) (r types.GetPayloadResponse, err error) {
+	err = e.rpc.Call(&r, GetPayloadV2, payloadID)
+	return
+}
+
+// GetPayloadV3 returns the payload built for payloadID with its value and blobs
+func (e *Engine) GetPayloadV3(payloadID string) (r types.GetPayloadResponse, err error) {
+	err = e.rpc.Call(&r, GetPayloadV3, payloadID)
+	return
+}
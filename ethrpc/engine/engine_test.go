@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/rpctest"
+	"github.com/alethio/web3-go/types"
+)
+
+const secretHex = "0x7365637265747365637265747365637265747365637265747365637265747365"
+
+func writeSecret(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "engine")
+	assert.NoError(t, err)
+	path := filepath.Join(dir, "jwtsecret")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path, func() { os.RemoveAll(dir) }
+}
+
+// verify checks the bearer token of header the way the execution clients do
+func verify(t *testing.T, header http.Header, secret []byte) {
+	token := strings.TrimPrefix(header.Get("Authorization"), "Bearer ")
+	parts := strings.Split(token, ".")
+	assert.Len(t, parts, 3)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), parts[2])
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	assert.NoError(t, err)
+	var claims struct {
+		IAT int64 `json:"iat"`
+	}
+	assert.NoError(t, json.Unmarshal(raw, &claims))
+	assert.InDelta(t, time.Now().Unix(), claims.IAT, 5)
+}
+
+func TestLoadSecret(t *testing.T) {
+	path, done := writeSecret(t, secretHex+"\n")
+	defer done()
+	secret, err := LoadSecret(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("secretsecretsecretsecretsecretse"), secret)
+
+	short, done := writeSecret(t, "0xabcd")
+	defer done()
+	_, err = LoadSecret(short)
+	assert.Error(t, err)
+
+	invalid, done := writeSecret(t, "not hex")
+	defer done()
+	_, err = LoadSecret(invalid)
+	assert.Error(t, err)
+}
+
+func TestEngine_HTTP(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle(NewPayloadV3, types.PayloadStatus{Status: types.PayloadValid, LatestValidHash: "0xb1"})
+	srv.Handle(ForkchoiceUpdatedV3, types.ForkchoiceUpdatedResponse{
+		PayloadStatus: types.PayloadStatus{Status: types.PayloadValid},
+		PayloadID:     "0x01",
+	})
+	srv.Handle(GetPayloadV3, map[string]interface{}{
+		"executionPayload": map[string]interface{}{"blockNumber": "0x10", "transactions": []string{}},
+		"blockValue":       "0x1",
+		"blobsBundle":      map[string]interface{}{"commitments": []string{}, "proofs": []string{}, "blobs": []string{}},
+	})
+
+	path, done := writeSecret(t, secretHex)
+	defer done()
+	e, err := NewWithDefaults(srv.URL, path)
+	assert.NoError(t, err)
+	defer e.Stop()
+
+	status, err := e.NewPayloadV3(types.ExecutionPayload{BlockNumber: "0x10"}, nil, "0xbeac")
+	assert.NoError(t, err)
+	assert.Equal(t, types.PayloadValid, status.Status)
+	assert.Equal(t, "0xb1", status.LatestValidHash)
+
+	fcu, err := e.ForkchoiceUpdatedV3(types.ForkchoiceState{HeadBlockHash: "0xb1"}, &types.PayloadAttributes{Timestamp: "0x1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "0x01", fcu.PayloadID)
+
+	payload, err := e.GetPayloadV3(fcu.PayloadID)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x10", payload.ExecutionPayload.BlockNumber)
+	assert.NotNil(t, payload.BlobsBundle)
+
+	secret, _ := LoadSecret(path)
+	for _, h := range srv.Headers() {
+		verify(t, h, secret)
+	}
+
+	requests := srv.Requests()
+	assert.Len(t, requests, 3)
+	assert.Len(t, requests[0].Params, 3)
+	assert.JSONEq(t, `[]`, string(requests[0].Params[1]))
+	assert.JSONEq(t, `"0xbeac"`, string(requests[0].Params[2]))
+
+	// withdrawals are mandatory from cancun on, even when there are none
+	var payloadParam, attributesParam map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(requests[0].Params[0], &payloadParam))
+	assert.JSONEq(t, `[]`, string(payloadParam["withdrawals"]))
+	assert.NoError(t, json.Unmarshal(requests[1].Params[1], &attributesParam))
+	assert.JSONEq(t, `[]`, string(attributesParam["withdrawals"]))
+}
+
+func TestEngine_Withdrawals(t *testing.T) {
+	// an empty list is kept, shanghai payloads without withdrawals must still carry it
+	raw, err := json.Marshal(types.ExecutionPayload{Withdrawals: []types.Withdrawal{}})
+	assert.NoError(t, err)
+	var payload map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(raw, &payload))
+	assert.JSONEq(t, `[]`, string(payload["withdrawals"]))
+
+	raw, err = json.Marshal(types.PayloadAttributes{Withdrawals: []types.Withdrawal{}})
+	assert.NoError(t, err)
+	var attributes map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(raw, &attributes))
+	assert.JSONEq(t, `[]`, string(attributes["withdrawals"]))
+
+	// nil withdrawals are null, a payload from before shanghai
+	raw, err = json.Marshal(types.ExecutionPayload{})
+	assert.NoError(t, err)
+	payload = nil
+	assert.NoError(t, json.Unmarshal(raw, &payload))
+	assert.JSONEq(t, `null`, string(payload["withdrawals"]))
+
+	// and an empty list read from a node is sent back as is
+	var decoded types.ExecutionPayload
+	assert.NoError(t, json.Unmarshal([]byte(`{"withdrawals":[]}`), &decoded))
+	assert.NotNil(t, decoded.Withdrawals)
+	raw, err = json.Marshal(decoded)
+	assert.NoError(t, err)
+	payload = nil
+	assert.NoError(t, json.Unmarshal(raw, &payload))
+	assert.JSONEq(t, `[]`, string(payload["withdrawals"]))
+}
+
+func TestEngine_WS(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle(ExchangeCapabilities, []string{NewPayloadV1})
+	srv.Handle(ForkchoiceUpdatedV1, types.ForkchoiceUpdatedResponse{PayloadStatus: types.PayloadStatus{Status: types.PayloadSyncing}})
+
+	path, done := writeSecret(t, secretHex)
+	defer done()
+	e, err := NewWithDefaults(srv.WSURL, path)
+	assert.NoError(t, err)
+	defer e.Stop()
+
+	supported, err := e.ExchangeCapabilities([]string{NewPayloadV1, NewPayloadV2})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{NewPayloadV1}, supported)
+
+	fcu, err := e.ForkchoiceUpdatedV1(types.ForkchoiceState{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, types.PayloadSyncing, fcu.PayloadStatus.Status)
+	assert.JSONEq(t, `null`, string(srv.Requests()[1].Params[1]))
+
+	// the token is sent with the handshake
+	secret, _ := LoadSecret(path)
+	assert.Len(t, srv.Headers(), 1)
+	verify(t, srv.Headers()[0], secret)
+}
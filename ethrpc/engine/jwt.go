@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SecretLength is the size in bytes of the jwt secret shared with the execution client
+const SecretLength = 32
+
+// LoadSecret reads the hex encoded jwt secret of the execution client, like geth's jwtsecret file
+func LoadSecret(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("jwt secret %s: %s", path, err)
+	}
+	if len(secret) != SecretLength {
+		return nil, fmt.Errorf("jwt secret %s: expected %d bytes, got %d", path, SecretLength, len(secret))
+	}
+	return secret, nil
+}
+
+// Token signs a HS256 jwt with only the iat claim, which is all the engine api asks for
+func Token(secret []byte, iat time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]int64{"iat": iat.Unix()})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil)), nil
+}
+
+// HeaderFunc returns the header function of the providers authenticating with a fresh
+// token every time. The execution clients refuse tokens older than a minute.
+func HeaderFunc(secret []byte) func() (http.Header, error) {
+	return func() (http.Header, error) {
+		token, err := Token(secret, time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		h := make(http.Header)
+		h.Set("Authorization", "Bearer "+token)
+		return h, nil
+	}
+}
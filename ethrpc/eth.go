@@ -4,7 +4,6 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math/big"
 	"strconv"
 	"strings"
@@ -14,14 +13,23 @@ import (
 
 	"github.com/alethio/web3-go/etherr"
 	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/ethrpc/provider/failover"
 	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/ethrpc/provider/ipcrpc"
 	"github.com/alethio/web3-go/ethrpc/provider/wsrpc"
+	"github.com/alethio/web3-go/logger"
 )
 
 // ETH server interaction
 type ETH struct {
 	rpc    provider.Interface
 	client string
+
+	// size of the channels of the subscription helpers, 0 = their own default
+	subscriptionBuffer int
+
+	log     logger.Logger
+	onError func(error)
 }
 
 // Start connects to parity and starts listening for notifications
@@ -287,71 +295,95 @@ func (e *ETH) TraceReplayBlockTransactions(blockNumber string, traceTypes ...str
 	return replays, err
 }
 
-// NewHeadsSubscription eth_subscribe to newHeads
-func (e *ETH) NewHeadsSubscription() (r chan *types.BlockHeader, err error) {
-	r = make(chan *types.BlockHeader, 100)
-	j := make(chan *json.RawMessage, 100)
-
-	go func(res chan<- *types.BlockHeader, notif <-chan *json.RawMessage) {
-		for notification := range notif {
-			var blockHead types.BlockHeader
-			err := json.Unmarshal(*notification, &blockHead)
-			if err != nil {
-				log.Fatal("unmarshal notification", err)
-			}
-			res <- &blockHead
-		}
-		close(res)
-	}(r, j)
+// DebugTraceTransaction replays a transaction on geth using the default struct logger,
+// use vmtrace.FromStructLogs to get a parity like vm trace out of it
+func (e *ETH) DebugTraceTransaction(hash string) (types.StructLogTrace, error) {
+	var t types.StructLogTrace
+	config := map[string]interface{}{
+		// recent geth versions leave the memory out by default
+		"enableMemory": true,
+	}
+	err := e.MakeRequest(&t, GETHDebugTraceTransaction, hash, config)
+	return t, err
+}
 
-	err = e.Subscribe(j, ETHSubscribe, ETHNewHeads)
+// NewHeadsSubscription eth_subscribe to newHeads, the errors go to the error handler.
+// See SubscribeNewHeads for a subscription with its errors.
+func (e *ETH) NewHeadsSubscription() (r chan *types.BlockHeader, err error) {
+	r = make(chan *types.BlockHeader, e.bufferSize(100))
+	s, err := e.subscribeNewHeads(r)
+	if err != nil {
+		return
+	}
+	go e.handleErrors(s)
 	return
 }
 
-// NewPendingTransactionsSubscription eth_subscribe to newPendingTransactions
+// NewPendingTransactionsSubscription eth_subscribe to newPendingTransactions, the errors
+// go to the error handler. See SubscribeNewPendingTransactions for a subscription with its errors.
 func (e *ETH) NewPendingTransactionsSubscription() (r chan *string, err error) {
-	r = make(chan *string, 10000)
-	j := make(chan *json.RawMessage, 10000)
-
-	go func(res chan<- *string, notif <-chan *json.RawMessage) {
-		for notification := range notif {
-			var tx string
-			err := json.Unmarshal(*notification, &tx)
-			if err != nil {
-				log.Fatal("unmarshal notification", err)
-			}
-			res <- &tx
-		}
-		close(res)
-	}(r, j)
-
-	err = e.Subscribe(j, ETHSubscribe, ETHNewPendingTransactions)
+	r = make(chan *string, e.bufferSize(10000))
+	s, err := e.subscribeNewPendingTransactions(r)
+	if err != nil {
+		return
+	}
+	go e.handleErrors(s)
 	return
 }
 
-// NewBlockNumberSubscription parity_subscribe to eth_blockNumber
+// NewBlockNumberSubscription parity_subscribe to eth_blockNumber, the errors go to the
+// error handler. See SubscribeBlockNumber for a subscription with its errors.
 func (e *ETH) NewBlockNumberSubscription() (r chan *int64, err error) {
-	r = make(chan *int64, 10000)
-	j := make(chan *json.RawMessage, 10000)
-
-	go func(res chan<- *int64, notif <-chan *json.RawMessage) {
-		for notification := range notif {
-			var bn string
-			err := json.Unmarshal(*notification, &bn)
-			if err != nil {
-				log.Fatal("unmarshal notification", err)
-			}
-			n, err := strconv.ParseInt(bn, 0, 64)
-			if err != nil {
-				log.Fatal("convert notification", err)
-			}
-			res <- &n
+	r = make(chan *int64, e.bufferSize(10000))
+	s, err := e.subscribeBlockNumber(r)
+	if err != nil {
+		return
+	}
+	go e.handleErrors(s)
+	return
+}
+
+// SetErrorHandler sets the function receiving the errors of the subscription helpers
+// returning a plain channel, like a notification that can not be decoded or the loss of
+// the connection, see Subscription. Without handler the errors are logged.
+func (e *ETH) SetErrorHandler(handler func(error)) {
+	e.onError = handler
+}
+
+// SetLogger sets the logger of the ETH, logger.Default otherwise
+func (e *ETH) SetLogger(l logger.Logger) {
+	e.log = l
+}
+
+// handleErrors hands the errors of s to the error handler until it ends
+func (e *ETH) handleErrors(s *Subscription) {
+	for err := range s.Err() {
+		if e.onError != nil {
+			e.onError(err)
+			continue
 		}
-		close(res)
-	}(r, j)
+		if err == etherr.ConnectionClosed {
+			// stopped on purpose
+			e.logger().Debugf("subscription: %s", err)
+			continue
+		}
+		e.logger().Errorf("subscription: %s", err)
+	}
+}
 
-	err = e.Subscribe(j, ParitySubscribe, ETHBlockNumber, []string{})
-	return
+func (e *ETH) logger() logger.Logger {
+	if e.log == nil {
+		return logger.Default()
+	}
+	return e.log
+}
+
+// bufferSize returns the size of the channels of a subscription helper
+func (e *ETH) bufferSize(defaultSize int) int {
+	if e.subscriptionBuffer > 0 {
+		return e.subscriptionBuffer
+	}
+	return defaultSize
 }
 
 // CallContractFunctionInt64 calls a contract's function and returns a decoded int64
@@ -403,40 +435,95 @@ func (e *ETH) Subscribe(receiver chan *json.RawMessage, method string, event str
 	return e.rpc.Subscribe(receiver, method, event, params...)
 }
 
-// New create a new ethereum server json rpc interface
-func New(provider provider.Interface) (*ETH, error) {
+// New create a new ethereum server json rpc interface, the calls go through
+// the interceptors before reaching the provider
+func New(p provider.Interface, interceptors ...provider.Interceptor) (*ETH, error) {
+	if len(interceptors) > 0 {
+		p = provider.Chain(p, interceptors...)
+	}
+
 	return &ETH{
-			rpc: provider,
+			rpc: p,
 		},
 		nil
 }
 
-// NewWithDefaults selects the proper provider based on protocol
+// NewWithDefaults selects the proper provider based on protocol, ipc:// urls and filesystem paths use the ipc socket
 func NewWithDefaults(url string) (*ETH, error) {
-	switch {
-	case strings.HasPrefix(url, "http"):
-		p, err := httprpc.New(url)
-		if err != nil {
-			return nil, err
-		}
-		e, err := New(p)
-		if err != nil {
-			return nil, err
-		}
+	return NewWithOptions(url)
+}
+
+// NewWithOptions selects the proper provider based on protocol like NewWithDefaults,
+// configuring it and the ETH with the options
+func NewWithOptions(url string, opts ...Option) (*ETH, error) {
+	o := options{reconnect: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	p, err := newProvider(url, &o)
+	if err != nil {
+		return nil, err
+	}
 
+	e, err := New(p, o.interceptors...)
+	if err != nil {
+		return nil, err
+	}
+	e.subscriptionBuffer = o.subscriptionBuffer
+	e.log = o.log
+	e.onError = o.onError
+
+	// there is no connection to start over http
+	if _, ok := p.(*httprpc.HTTPProvider); ok {
 		return e, nil
+	}
+	return e, e.Start()
+}
+
+// NewProvider creates the provider of url, selected on its protocol: http(s), ws(s), ipc://
+// or a socket path. Only the options of the transports and WithReconnect apply, the
+// provider is not started.
+func NewProvider(url string, opts ...Option) (provider.Interface, error) {
+	o := options{reconnect: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return newProvider(url, &o)
+}
+
+func newProvider(url string, o *options) (provider.Interface, error) {
+	switch {
+	case strings.HasPrefix(url, "http"):
+		return httprpc.New(url, o.http...)
 	case strings.HasPrefix(url, "ws"):
-		p, err := wsrpc.New(url, true)
-		if err != nil {
-			return nil, err
-		}
-		e, err := New(p)
+		return wsrpc.New(url, o.reconnect, o.ws...)
+	case ipcrpc.IsPath(url):
+		return ipcrpc.New(url, o.ipc...)
+	}
+	return nil, fmt.Errorf("protocol not recognized for %s, use http(s), ws(s), ipc:// or a socket path", url)
+}
+
+// NewWithFailover creates a provider for every url, calls go to the first healthy one in the given order
+func NewWithFailover(urls ...string) (*ETH, error) {
+	var providers []provider.Interface
+	for _, url := range urls {
+		// reconnecting is left to the failover provider
+		p, err := NewProvider(url, WithReconnect(false))
 		if err != nil {
 			return nil, err
 		}
+		providers = append(providers, p)
+	}
 
-		return e, e.Start()
+	p, err := failover.New(failover.DefaultTimeout, failover.DefaultCooldown, providers...)
+	if err != nil {
+		return nil, err
+	}
+	e, err := New(p)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("protocol not recognized, use http(s) or ws(s)")
+	return e, e.Start()
 }
@@ -12,8 +12,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 
-	mock "github.com/alethio/ethmock/server"
 	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/rpctest"
 )
 
 var update = flag.Bool("update", false, "update golden files")
@@ -119,13 +119,13 @@ func TestRequests(t *testing.T) {
 	}
 }
 
-func setup(t *testing.T) (*ETH, func() error) {
+func setup(t *testing.T) (*ETH, func()) {
 	t.Helper()
-	srv, err := mock.New(8545, "../testdata/mock")
+	srv := rpctest.NewServer()
+	err := srv.LoadMock("../testdata/mock")
 	assert.Nil(t, err)
-	go srv.Serve()
 
-	p, err := httprpc.New("http://localhost:8545")
+	p, err := httprpc.New(srv.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -12,6 +12,7 @@ type ETHInterface interface {
 	CallContractFunction(function string, address string, gas string) (string, error)
 	CallContractFunctionBigInt(function string, address string) (*big.Int, error)
 	CallContractFunctionInt64(function string, address string) (int64, error)
+	DebugTraceTransaction(hash string) (types.StructLogTrace, error)
 	GetBalanceAtBlock(address, blockNumber string) (*big.Int, error)
 	GetBlockByNumber(number string) (b types.Block, err error)
 	GetBlockNumber() (int64, error)
@@ -41,6 +42,9 @@ type ETHInterface interface {
 	NewBlockNumberSubscription() (r chan *int64, err error)
 	NewHeadsSubscription() (r chan *types.BlockHeader, err error)
 	NewPendingTransactionsSubscription() (r chan *string, err error)
+	SubscribeNewHeads() (*HeadsSubscription, error)
+	SubscribeNewPendingTransactions() (*PendingTransactionsSubscription, error)
+	SubscribeBlockNumber() (*BlockNumberSubscription, error)
 	SetPendingTransactionsFilter() (id string, err error)
 	Start() error
 	Stop()
@@ -0,0 +1,126 @@
+package ethrpc
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/ethrpc/provider/ipcrpc"
+	"github.com/alethio/web3-go/ethrpc/provider/wsrpc"
+	"github.com/alethio/web3-go/logger"
+)
+
+// Option configures an ETH created by NewWithOptions and its provider
+type Option func(o *options)
+
+type options struct {
+	http               []httprpc.Option
+	ws                 []wsrpc.Option
+	ipc                []ipcrpc.Option
+	reconnect          bool
+	interceptors       []provider.Interceptor
+	subscriptionBuffer int
+	log                logger.Logger
+	onError            func(error)
+}
+
+// WithHTTPOptions passes options to the http provider
+func WithHTTPOptions(opts ...httprpc.Option) Option {
+	return func(o *options) {
+		o.http = append(o.http, opts...)
+	}
+}
+
+// WithWSOptions passes options to the websocket provider
+func WithWSOptions(opts ...wsrpc.Option) Option {
+	return func(o *options) {
+		o.ws = append(o.ws, opts...)
+	}
+}
+
+// WithIPCOptions passes options to the ipc provider
+func WithIPCOptions(opts ...ipcrpc.Option) Option {
+	return func(o *options) {
+		o.ipc = append(o.ipc, opts...)
+	}
+}
+
+// WithTimeout sets the timeout of the http requests and of the websocket handshakes and calls
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.http = append(o.http, httprpc.WithTimeout(d))
+		o.ws = append(o.ws, wsrpc.WithHandshakeTimeout(d), wsrpc.WithCallTimeout(d))
+	}
+}
+
+// WithTLSConfig sets the tls configuration of https and wss connections
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *options) {
+		o.http = append(o.http, httprpc.WithTLSConfig(config))
+		o.ws = append(o.ws, wsrpc.WithTLSConfig(config))
+	}
+}
+
+// WithProxy sets the function picking the proxy of the connections, like http.ProxyFromEnvironment
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(o *options) {
+		o.http = append(o.http, httprpc.WithProxy(proxy))
+		o.ws = append(o.ws, wsrpc.WithProxy(proxy))
+	}
+}
+
+// WithHeader sets a header sent with every http request and websocket handshake
+func WithHeader(key, value string) Option {
+	return func(o *options) {
+		o.http = append(o.http, httprpc.WithHeader(key, value))
+		o.ws = append(o.ws, wsrpc.WithHeader(key, value))
+	}
+}
+
+// WithLoader sets the loader of the http provider, like a BatchLoader
+func WithLoader(loader httprpc.RPCLoader) Option {
+	return func(o *options) {
+		o.http = append(o.http, httprpc.WithLoader(loader))
+	}
+}
+
+// WithLogger sets the logger of the ETH and of the websocket and ipc providers,
+// see the logger package for the adapters
+func WithLogger(l logger.Logger) Option {
+	return func(o *options) {
+		o.log = l
+		o.ws = append(o.ws, wsrpc.WithLogger(l))
+		o.ipc = append(o.ipc, ipcrpc.WithLogger(l))
+	}
+}
+
+// WithErrorHandler sets the function receiving the errors of the subscription helpers returning a plain channel, see ETH.SetErrorHandler
+func WithErrorHandler(handler func(error)) Option {
+	return func(o *options) {
+		o.onError = handler
+	}
+}
+
+// WithReconnect makes the websocket provider retry connecting until it succeeds, the default
+func WithReconnect(enabled bool) Option {
+	return func(o *options) {
+		o.reconnect = enabled
+	}
+}
+
+// WithInterceptors makes the calls go through the interceptors, see New
+func WithInterceptors(interceptors ...provider.Interceptor) Option {
+	return func(o *options) {
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+// WithSubscriptionBuffer sets the size of the channels of the subscription helpers
+func WithSubscriptionBuffer(n int) Option {
+	return func(o *options) {
+		o.subscriptionBuffer = n
+	}
+}
@@ -0,0 +1,100 @@
+package ethrpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/logger"
+	"github.com/alethio/web3-go/rpctest"
+)
+
+func TestNewWithOptions_HTTP(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle(ETHBlockNumber, "0x10")
+
+	var methods []string
+	eth, err := NewWithOptions(srv.URL,
+		WithHeader("X-Api-Key", "key"),
+		WithTimeout(20*time.Millisecond),
+		WithHTTPOptions(httprpc.WithMaxIdleConns(4)),
+		WithInterceptors(func(next provider.Handler) provider.Handler {
+			return func(req *provider.Request) ([]byte, error) {
+				methods = append(methods, req.Method)
+				return next(req)
+			}
+		}),
+	)
+	assert.NoError(t, err)
+
+	n, err := eth.GetBlockNumber()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(16), n)
+	assert.Equal(t, []string{ETHBlockNumber}, methods)
+	assert.Equal(t, "key", srv.Headers()[0].Get("X-Api-Key"))
+
+	srv.SetLatency(100 * time.Millisecond)
+	_, err = eth.GetBlockNumber()
+	assert.Error(t, err, "the request times out")
+
+	_, err = NewWithOptions(srv.URL, WithHTTPOptions(httprpc.WithMaxIdleConns(-1)))
+	assert.Error(t, err)
+	_, err = NewWithOptions("ftp://node")
+	assert.Error(t, err)
+}
+
+func TestNewWithOptions_WS(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle(WEB3ClientVersion, "Geth/v1.9.0")
+
+	eth, err := NewWithOptions(srv.WSURL, WithHeader("X-Api-Key", "key"), WithReconnect(false), WithSubscriptionBuffer(3))
+	assert.NoError(t, err)
+	defer eth.Stop()
+
+	heads, err := eth.NewHeadsSubscription()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, cap(heads))
+	assert.Equal(t, "key", srv.Headers()[0].Get("X-Api-Key"))
+}
+
+func TestNewWithOptions_ErrorHandler(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle(WEB3ClientVersion, "Geth/v1.9.0")
+
+	errs := make(chan error, 1)
+	eth, err := NewWithOptions(srv.WSURL,
+		WithReconnect(false),
+		WithLogger(logger.Nop()),
+		WithErrorHandler(func(err error) { errs <- err }),
+	)
+	assert.NoError(t, err)
+	defer eth.Stop()
+
+	heads, err := eth.NewHeadsSubscription()
+	assert.NoError(t, err)
+
+	// a head that can not be decoded is reported and skipped, the subscription goes on
+	_, err = srv.Notify(ETHNewHeads, "not a head")
+	assert.NoError(t, err)
+	select {
+	case err := <-errs:
+		assert.Contains(t, err.Error(), "newHeads notification")
+	case <-time.After(time.Second):
+		t.Fatal("the error handler was not called")
+	}
+
+	_, err = srv.Notify(ETHNewHeads, map[string]string{"number": "0x1"})
+	assert.NoError(t, err)
+	select {
+	case head := <-heads:
+		assert.Equal(t, "0x1", head.Number)
+	case <-time.After(time.Second):
+		t.Fatal("no head after the bad one")
+	}
+}
@@ -0,0 +1,35 @@
+package provider
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// StripUserinfo removes the user and password from rawurl, they are returned as
+// a basic auth header. The header is empty when the url has no userinfo.
+func StripUserinfo(rawurl string) (string, http.Header, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	header := make(http.Header)
+	if u.User == nil {
+		return rawurl, header, nil
+	}
+
+	password, _ := u.User.Password()
+	req := &http.Request{Header: header}
+	req.SetBasicAuth(u.User.Username(), password)
+	u.User = nil
+	return u.String(), header, nil
+}
+
+// MergeHeaders adds the values of every header to dst, later headers replace the keys of earlier ones
+func MergeHeaders(dst http.Header, headers ...http.Header) {
+	for _, h := range headers {
+		for k, v := range h {
+			dst[k] = append([]string(nil), v...)
+		}
+	}
+}
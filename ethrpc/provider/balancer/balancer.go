@@ -0,0 +1,327 @@
+// Package balancer spreads the calls over several providers, keeping away
+// from the ones lagging behind the chain tip
+package balancer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alethio/web3-go/ethrpc/provider"
+)
+
+const (
+	// DefaultMaxLag is the default number of blocks a backend may be behind the best one
+	DefaultMaxLag = 2
+
+	// DefaultPollInterval is the default interval between two eth_blockNumber polls
+	DefaultPollInterval = 5 * time.Second
+)
+
+// Strategy picks the backend for a call among the eligible ones
+type Strategy int
+
+// balancing strategies
+const (
+	// RoundRobin takes the eligible backends in turn
+	RoundRobin Strategy = iota
+	// Weighted picks a random backend with a probability proportional to its weight
+	Weighted
+	// LeastInFlight picks the backend with the fewest calls in progress
+	LeastInFlight
+)
+
+// Backend is a provider together with its weight, used by the Weighted strategy
+type Backend struct {
+	Provider provider.Interface
+	Weight   int
+}
+
+type backend struct {
+	Backend
+	height   int64
+	polled   bool
+	inFlight int
+}
+
+// Provider balances the calls over the backends which are close enough to the chain tip
+type Provider struct {
+	backends []*backend
+	strategy Strategy
+	maxLag   int64
+	interval time.Duration
+
+	mu   sync.Mutex
+	next int
+	stop chan struct{}
+}
+
+// New creates a balancer. Backends more than maxLag blocks behind the best one are left
+// out; heights are polled every interval once the provider is started.
+func New(strategy Strategy, maxLag int64, interval time.Duration, backends ...Backend) (*Provider, error) {
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("At least one backend is needed")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("Poll interval must be positive")
+	}
+
+	p := &Provider{
+		strategy: strategy,
+		maxLag:   maxLag,
+		interval: interval,
+	}
+	for _, b := range backends {
+		if b.Weight <= 0 {
+			b.Weight = 1
+		}
+		p.backends = append(p.backends, &backend{Backend: b})
+	}
+	return p, nil
+}
+
+// NewWithDefaults balances round robin over the providers with the default lag and poll interval
+func NewWithDefaults(providers ...provider.Interface) (*Provider, error) {
+	var backends []Backend
+	for _, pr := range providers {
+		backends = append(backends, Backend{Provider: pr, Weight: 1})
+	}
+	return New(RoundRobin, DefaultMaxLag, DefaultPollInterval, backends...)
+}
+
+// Start starts the backends and the height polling
+func (p *Provider) Start() error {
+	for _, b := range p.backends {
+		if err := b.Provider.Start(); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	p.stop = make(chan struct{})
+	stop := p.stop
+	p.mu.Unlock()
+
+	p.poll()
+	go p.pollLoop(stop)
+	return nil
+}
+
+// Stop stops the height polling and the backends
+func (p *Provider) Stop() {
+	p.mu.Lock()
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+	p.mu.Unlock()
+
+	for _, b := range p.backends {
+		b.Provider.Stop()
+	}
+}
+
+// Heights returns the last polled block number of every backend, -1 if unknown
+func (p *Provider) Heights() []int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	h := make([]int64, len(p.backends))
+	for i, b := range p.backends {
+		h[i] = -1
+		if b.polled {
+			h[i] = b.height
+		}
+	}
+	return h
+}
+
+// CallRaw calls a RPC method on one of the eligible backends
+func (p *Provider) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	b := p.pick(method, params)
+	defer p.done(b)
+
+	return b.Provider.CallRaw(method, params...)
+}
+
+// Call calls a RPC method on one of the eligible backends
+func (p *Provider) Call(result interface{}, method string, params ...interface{}) error {
+	b := p.pick(method, params)
+	defer p.done(b)
+
+	return b.Provider.Call(result, method, params...)
+}
+
+// CallBatch sends the batch to one of the backends which have reached every block it refers to
+func (p *Provider) CallBatch(batch []*provider.BatchElem) error {
+	var highest int64
+	specific := false
+	for _, elem := range batch {
+		if block, ok := provider.BlockNumber(elem.Method, elem.Params); ok {
+			specific = true
+			if block > highest {
+				highest = block
+			}
+		}
+	}
+
+	b := p.pickAt(highest, specific)
+	defer p.done(b)
+
+	return provider.CallBatch(b.Provider, batch)
+}
+
+// Subscribe subscribes on the highest backend supporting subscriptions
+func (p *Provider) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	return p.SubscribeErr(receiver, nil, method, event, params...)
+}
+
+// SubscribeErr is Subscribe with errs receiving the errors of the subscription from the
+// backend, see provider.ErrSubscriber
+func (p *Provider) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	// the heights are written by the polls
+	p.mu.Lock()
+	order := make([]*backend, len(p.backends))
+	copy(order, p.backends)
+	heights := make([]int64, len(p.backends))
+	for i, b := range p.backends {
+		heights[i] = b.height
+	}
+	p.mu.Unlock()
+
+	var err error
+	for len(order) > 0 {
+		best := 0
+		for i := range order {
+			if heights[i] > heights[best] {
+				best = i
+			}
+		}
+
+		err = provider.SubscribeErr(order[best].Provider, receiver, errs, method, event, params...)
+		if err == nil {
+			return nil
+		}
+		order = append(order[:best], order[best+1:]...)
+		heights = append(heights[:best], heights[best+1:]...)
+	}
+	return err
+}
+
+func (p *Provider) pollLoop(stop chan struct{}) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.poll()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// poll asks every backend for its block number in parallel, the height of a backend which
+// does not answer is forgotten until it does
+func (p *Provider) poll() {
+	var wg sync.WaitGroup
+	for _, b := range p.backends {
+		wg.Add(1)
+		go func(b *backend) {
+			defer wg.Done()
+
+			var n string
+			err := b.Provider.Call(&n, "eth_blockNumber")
+			var height int64
+			if err == nil {
+				height, err = strconv.ParseInt(n, 0, 64)
+			}
+
+			p.mu.Lock()
+			b.height = height
+			b.polled = err == nil
+			p.mu.Unlock()
+		}(b)
+	}
+	wg.Wait()
+}
+
+// pick selects the backend for a call and counts it as in flight
+func (p *Provider) pick(method string, params []interface{}) *backend {
+	block, specific := provider.BlockNumber(method, params)
+	return p.pickAt(block, specific)
+}
+
+// pickAt selects a backend which has reached block, when specific, and counts it as in flight
+func (p *Provider) pickAt(block int64, specific bool) *backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var top int64
+	for _, b := range p.backends {
+		if b.polled && b.height > top {
+			top = b.height
+		}
+	}
+	// the block may have come out since the last poll, the highest backends are the
+	// most likely to have it
+	if specific && block > top {
+		block = top
+	}
+
+	var eligible []*backend
+	for _, b := range p.backends {
+		// backends which never answered a poll are only used as a last resort
+		if !b.polled || top-b.height > p.maxLag {
+			continue
+		}
+		if specific && b.height < block {
+			continue
+		}
+		eligible = append(eligible, b)
+	}
+
+	if len(eligible) == 0 {
+		eligible = p.backends
+	}
+
+	var b *backend
+	switch p.strategy {
+	case Weighted:
+		total := 0
+		for _, e := range eligible {
+			total += e.Weight
+		}
+		r := rand.Intn(total)
+		for _, e := range eligible {
+			r -= e.Weight
+			if r < 0 {
+				b = e
+				break
+			}
+		}
+	case LeastInFlight:
+		b = eligible[0]
+		for _, e := range eligible[1:] {
+			if e.inFlight < b.inFlight {
+				b = e
+			}
+		}
+	default:
+		b = eligible[p.next%len(eligible)]
+		p.next++
+	}
+
+	b.inFlight++
+	return b
+}
+
+func (p *Provider) done(b *backend) {
+	p.mu.Lock()
+	b.inFlight--
+	p.mu.Unlock()
+}
@@ -0,0 +1,165 @@
+package balancer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// node answers eth_blockNumber with its height and counts the other calls
+type node struct {
+	mu         sync.Mutex
+	height     int64
+	calls      int
+	subscribed int
+	errs       chan error
+	down       bool
+}
+
+func (n *node) Start() error { return nil }
+func (n *node) Stop()        {}
+func (n *node) Call(result interface{}, method string, params ...interface{}) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if method == "eth_blockNumber" {
+		if n.down {
+			return fmt.Errorf("connection refused")
+		}
+		*result.(*string) = fmt.Sprintf("0x%x", n.height)
+		return nil
+	}
+	n.calls++
+	return nil
+}
+func (n *node) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	return nil, n.Call(nil, method, params...)
+}
+func (n *node) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.subscribed++
+	return nil
+}
+func (n *node) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	n.mu.Lock()
+	n.errs = errs
+	n.mu.Unlock()
+	return n.Subscribe(receiver, method, event, params...)
+}
+func (n *node) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls
+}
+
+func TestProvider_Call(t *testing.T) {
+	tip, behind, laggard := &node{height: 100}, &node{height: 99}, &node{height: 50}
+	p, err := New(RoundRobin, 2, time.Hour, Backend{tip, 1}, Backend{behind, 1}, Backend{laggard, 1})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	assert.Equal(t, []int64{100, 99, 50}, p.Heights())
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, p.Call(nil, "eth_getBlockByNumber", "latest", false))
+	}
+	assert.Equal(t, 5, tip.count())
+	assert.Equal(t, 5, behind.count())
+	assert.Equal(t, 0, laggard.count())
+
+	// only the tip has block 100
+	assert.NoError(t, p.Call(nil, "eth_getBlockByNumber", "0x64", false))
+	assert.NoError(t, p.Call(nil, "eth_getBalance", "0x0", "0x64"))
+	assert.Equal(t, 7, tip.count())
+	assert.Equal(t, 5, behind.count())
+
+	// a block newer than the last poll goes to the highest backend
+	assert.NoError(t, p.Call(nil, "eth_getBlockByNumber", "0x65", false))
+	assert.Equal(t, 8, tip.count())
+	assert.Equal(t, 5, behind.count())
+}
+
+func TestProvider_PollFailure(t *testing.T) {
+	tip, behind := &node{height: 100}, &node{height: 99}
+	p, err := New(RoundRobin, 2, time.Hour, Backend{tip, 1}, Backend{behind, 1})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	// the tip stops answering, its height is forgotten and it is left out
+	tip.mu.Lock()
+	tip.down = true
+	tip.mu.Unlock()
+	p.poll()
+	assert.Equal(t, []int64{-1, 99}, p.Heights())
+
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, p.Call(nil, "eth_getBlockByNumber", "latest", false))
+	}
+	assert.Equal(t, 0, tip.count())
+	assert.Equal(t, 4, behind.count())
+}
+
+func TestProvider_Strategies(t *testing.T) {
+	heavy, light := &node{height: 10}, &node{height: 10}
+	p, err := New(Weighted, 2, time.Hour, Backend{heavy, 9}, Backend{light, 1})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, p.Call(nil, "eth_gasPrice"))
+	}
+	assert.True(t, heavy.count() > light.count()*3)
+
+	first, second := &node{height: 10}, &node{height: 10}
+	p, err = New(LeastInFlight, 2, time.Hour, Backend{first, 1}, Backend{second, 1})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	busy := p.pick("eth_gasPrice", nil)
+	for i := 0; i < 3; i++ {
+		b := p.pick("eth_gasPrice", nil)
+		assert.True(t, busy != b)
+		p.done(b)
+	}
+}
+
+func TestProvider_Subscribe(t *testing.T) {
+	tip, behind := &node{height: 100}, &node{height: 99}
+	p, err := New(RoundRobin, 2, time.Millisecond, Backend{behind, 1}, Backend{tip, 1})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	// the polls go on meanwhile
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, p.Subscribe(make(chan *json.RawMessage), "eth_subscribe", "newHeads"))
+		time.Sleep(time.Millisecond)
+	}
+	tip.mu.Lock()
+	assert.Equal(t, 10, tip.subscribed)
+	tip.mu.Unlock()
+}
+
+func TestProvider_SubscribeErr(t *testing.T) {
+	tip, behind := &node{height: 100}, &node{height: 99}
+	p, err := New(RoundRobin, 2, time.Hour, Backend{behind, 1}, Backend{tip, 1})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	errs := make(chan error, 1)
+	assert.NoError(t, p.SubscribeErr(make(chan *json.RawMessage), errs, "eth_subscribe", "newHeads"))
+	tip.mu.Lock()
+	defer tip.mu.Unlock()
+	assert.Equal(t, errs, tip.errs)
+	assert.Nil(t, behind.errs)
+}
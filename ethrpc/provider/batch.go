@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/jsonrpc2"
+)
+
+// BatchElem is one call of a batch
+type BatchElem struct {
+	Method string
+	Params []interface{}
+	// Result receives the decoded result, like the result of Call
+	Result interface{}
+	// Error is set when this call failed, the rest of the batch may have succeeded
+	Error error
+	// Raw is the json rpc response of the call, when the provider got one
+	Raw json.RawMessage
+}
+
+// Batcher is implemented by the providers able to send many calls in one round trip
+type Batcher interface {
+	// CallBatch sends every call at once. The returned error is about the batch as a
+	// whole, the errors of the calls are set on their element.
+	CallBatch(batch []*BatchElem) error
+}
+
+// CallBatch sends the batch in one round trip when p is a Batcher, one call after the other
+// otherwise. When the batch fails as a whole every call gets the error.
+func CallBatch(p Interface, batch []*BatchElem) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if b, ok := p.(Batcher); ok {
+		err := b.CallBatch(batch)
+		if err != nil {
+			for _, elem := range batch {
+				elem.Error = err
+			}
+		}
+		return err
+	}
+
+	callEach(p, batch)
+	return nil
+}
+
+// callEach makes the calls of a batch one after the other
+func callEach(p Interface, batch []*BatchElem) {
+	for _, elem := range batch {
+		elem.Raw, elem.Error = p.CallRaw(elem.Method, elem.Params...)
+		if elem.Error == nil {
+			elem.Error = Decode(elem.Raw, elem.Result)
+		}
+	}
+}
+
+// BatchRequests builds the requests of a batch, each with its own id
+func BatchRequests(batch []*BatchElem) []*jsonrpc2.JSONRPCRequest {
+	requests := make([]*jsonrpc2.JSONRPCRequest, len(batch))
+	for i, elem := range batch {
+		requests[i] = jsonrpc2.BuildRequest(elem.Method, elem.Params)
+	}
+	return requests
+}
+
+// DecodeBatch decodes the responses into the elements of the batch, see MatchResponses
+func DecodeBatch(batch []*BatchElem, requests []*jsonrpc2.JSONRPCRequest, responses []*jsonrpc2.JSONRPCMessage) {
+	matched, errs := MatchResponses(requests, responses)
+	for i, elem := range batch {
+		if errs[i] != nil {
+			elem.Error = errs[i]
+			continue
+		}
+		elem.Raw = matched[i].Raw
+		elem.Error = DecodeResult(matched[i], elem.Result)
+	}
+}
+
+// MatchResponses pairs the responses of a batch with its requests by id, the node
+// is free to answer in any order. Requests without a response get
+// etherr.MissingResponse, requests answered more than once etherr.DuplicateResponse.
+func MatchResponses(requests []*jsonrpc2.JSONRPCRequest, responses []*jsonrpc2.JSONRPCMessage) ([]*jsonrpc2.JSONRPCMessage, []error) {
+	byID := make(map[string]*jsonrpc2.JSONRPCMessage, len(responses))
+	duplicates := make(map[string]bool)
+	for _, resp := range responses {
+		if _, ok := byID[resp.ID]; ok {
+			duplicates[resp.ID] = true
+		}
+		byID[resp.ID] = resp
+	}
+
+	matched := make([]*jsonrpc2.JSONRPCMessage, len(requests))
+	errs := make([]error, len(requests))
+	for i, req := range requests {
+		resp, ok := byID[req.ID]
+		switch {
+		case !ok:
+			errs[i] = etherr.MissingResponse
+		case duplicates[req.ID]:
+			errs[i] = etherr.DuplicateResponse
+		default:
+			matched[i] = resp
+		}
+	}
+	return matched, errs
+}
+
+// DecodeBatchResponse decodes the answer to a batch. A node rejecting the batch as a
+// whole answers a single error object instead of an array, it is returned as the error.
+// Entries which can not be decoded are left out, their request ends up without response.
+func DecodeBatchResponse(raw []byte) ([]*jsonrpc2.JSONRPCMessage, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		msg, err := jsonrpc2.DecodeResponse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Error != nil {
+			return nil, etherr.New(msg.Error.Message, msg.Error.Code, msg.Error.Data)
+		}
+		return nil, jsonrpc2.DecodeError{Raw: raw, Err: fmt.Errorf("batch answered with a single response")}
+	}
+
+	entries, err := jsonrpc2.DecodeResponses(raw)
+	if err != nil {
+		return nil, err
+	}
+	messages := make([]*jsonrpc2.JSONRPCMessage, 0, len(entries))
+	for _, entry := range entries {
+		msg, err := jsonrpc2.DecodeResponse(entry)
+		if err != nil {
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
@@ -0,0 +1,42 @@
+package provider
+
+import "strconv"
+
+// BlockParams is the position of the block number parameter of the block specific methods
+var BlockParams = map[string]int{
+	"eth_getBlockByNumber":                    0,
+	"eth_getBlockTransactionCountByNumber":    0,
+	"eth_getUncleByBlockNumberAndIndex":       0,
+	"eth_getUncleCountByBlockNumber":          0,
+	"eth_getTransactionByBlockNumberAndIndex": 0,
+	"trace_block":                             0,
+	"trace_replayBlockTransactions":           0,
+	"eth_getBalance":                          1,
+	"eth_getCode":                             1,
+	"eth_getTransactionCount":                 1,
+	"eth_call":                                1,
+	"eth_getStorageAt":                        2,
+}
+
+// BlockNumber returns the block a call of method refers to, if it is a specific one.
+// Tags like "latest" move with the chain, they are not block numbers.
+func BlockNumber(method string, params []interface{}) (int64, bool) {
+	i, ok := BlockParams[method]
+	if !ok || i >= len(params) {
+		return 0, false
+	}
+	return ParseBlockNumber(params[i])
+}
+
+// ParseBlockNumber parses a hex or decimal block number parameter
+func ParseBlockNumber(param interface{}) (int64, bool) {
+	s, ok := param.(string)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
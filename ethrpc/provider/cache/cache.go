@@ -0,0 +1,323 @@
+// Package cache wraps a provider keeping the responses which can not change anymore,
+// like blocks by hash or state at a block deep enough to be safe from reorgs
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/jsonrpc2"
+)
+
+const (
+	// DefaultDepth is the default number of blocks a block needs below the head to be cached
+	DefaultDepth = 12
+
+	// DefaultHeadTTL is the default time the head block number is trusted before asking again
+	DefaultHeadTTL = 5 * time.Second
+)
+
+// Rule tells how to find the block a response belongs to
+type Rule struct {
+	// BlockParam is the position of the block number parameter, -1 if there is none
+	BlockParam int
+	// ResultBlock means the block number is read from the blockNumber field of the result,
+	// responses not yet in a block are not cached
+	ResultBlock bool
+}
+
+// Immutable is the rule for methods whose responses never change, like lookups by block hash
+var Immutable = Rule{BlockParam: -1}
+
+// DefaultRules are the methods cached by default: lookups by hash and the block
+// specific methods of provider.BlockParams
+var DefaultRules = defaultRules()
+
+func defaultRules() map[string]Rule {
+	rules := map[string]Rule{
+		"eth_getBlockByHash":                    Immutable,
+		"eth_getBlockTransactionCountByHash":    Immutable,
+		"eth_getUncleByBlockHashAndIndex":       Immutable,
+		"eth_getTransactionByBlockHashAndIndex": Immutable,
+		"eth_getTransactionByHash":              {BlockParam: -1, ResultBlock: true},
+		"eth_getTransactionReceipt":             {BlockParam: -1, ResultBlock: true},
+	}
+	for method, i := range provider.BlockParams {
+		rules[method] = Rule{BlockParam: i}
+	}
+	return rules
+}
+
+// Provider answers the cacheable calls from the store and the others from the wrapped provider
+type Provider struct {
+	next    provider.Interface
+	store   Store
+	rules   map[string]Rule
+	depth   int64
+	headTTL time.Duration
+
+	mu       sync.Mutex
+	head     int64
+	headTime time.Time
+	hits     int64
+	misses   int64
+}
+
+// New wraps a provider caching into store the responses of the methods in rules,
+// nil rules means DefaultRules. Blocks closer than depth to the head are not cached.
+func New(next provider.Interface, store Store, rules map[string]Rule, depth int64) (*Provider, error) {
+	if depth < 0 {
+		return nil, fmt.Errorf("Reorg depth can not be negative")
+	}
+	if rules == nil {
+		rules = DefaultRules
+	}
+
+	return &Provider{
+		next:    next,
+		store:   store,
+		rules:   rules,
+		depth:   depth,
+		headTTL: DefaultHeadTTL,
+	}, nil
+}
+
+// SetHeadTTL sets how long the head block number is trusted before asking again
+func (p *Provider) SetHeadTTL(ttl time.Duration) {
+	p.mu.Lock()
+	p.headTTL = ttl
+	p.mu.Unlock()
+}
+
+// Stats returns the number of cache hits and misses of cacheable calls
+func (p *Provider) Stats() (hits, misses int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.hits, p.misses
+}
+
+// Start starts the wrapped provider
+func (p *Provider) Start() error {
+	return p.next.Start()
+}
+
+// Stop stops the wrapped provider
+func (p *Provider) Stop() {
+	p.next.Stop()
+}
+
+// CallRaw calls a RPC method, answering from the cache when possible
+func (p *Provider) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	key, block, ok := p.key(method, params)
+	if !ok {
+		return p.next.CallRaw(method, params...)
+	}
+
+	if raw, ok := p.get(key); ok {
+		return raw, nil
+	}
+
+	raw, err := p.next.CallRaw(method, params...)
+	if err != nil {
+		return raw, err
+	}
+	p.keep(key, p.rules[method], block, raw)
+	return raw, nil
+}
+
+// CallBatch answers the calls of the batch from the cache when possible, the other
+// ones are sent through the wrapped provider in a single batch
+func (p *Provider) CallBatch(batch []*provider.BatchElem) error {
+	var missed []*provider.BatchElem
+	for _, elem := range batch {
+		if key, _, ok := p.key(elem.Method, elem.Params); ok {
+			if raw, ok := p.get(key); ok {
+				elem.Raw = raw
+				elem.Error = provider.Decode(raw, elem.Result)
+				continue
+			}
+		}
+		missed = append(missed, elem)
+	}
+
+	if err := provider.CallBatch(p.next, missed); err != nil {
+		return err
+	}
+	for _, elem := range missed {
+		if key, block, ok := p.key(elem.Method, elem.Params); ok && elem.Raw != nil {
+			p.keep(key, p.rules[elem.Method], block, elem.Raw)
+		}
+	}
+	return nil
+}
+
+// key returns the store key of a cacheable call and the block it refers to, -1 if the
+// block is only known from the result
+func (p *Provider) key(method string, params []interface{}) (string, int64, bool) {
+	rule, ok := p.rules[method]
+	if !ok {
+		return "", 0, false
+	}
+
+	var block int64 = -1
+	if rule.BlockParam >= 0 {
+		ok = rule.BlockParam < len(params)
+		if ok {
+			block, ok = provider.ParseBlockNumber(params[rule.BlockParam])
+		}
+		if !ok {
+			// latest, pending or anything else moving with the chain
+			return "", 0, false
+		}
+	}
+
+	key, err := Key(method, params)
+	if err != nil {
+		return "", 0, false
+	}
+	return key, block, true
+}
+
+// get returns the stored response of a cacheable call, counting hits and misses
+func (p *Provider) get(key string) ([]byte, bool) {
+	stored, ok := p.store.Get(key)
+	var resp *jsonrpc2.JSONRPCMessage
+	if ok {
+		var err error
+		resp, err = jsonrpc2.DecodeResponse(stored)
+		ok = err == nil && len(resp.Result) > 0
+	}
+	p.count(ok)
+	if !ok {
+		return nil, false
+	}
+	// the id of the request which filled the cache means nothing to this caller
+	return response(jsonrpc2.NextID(), resp.Result), true
+}
+
+// response encodes a response holding result, without id when id is empty
+func response(id string, result json.RawMessage) []byte {
+	var raw []byte
+	if id == "" {
+		raw = []byte(`{"jsonrpc":"2.0","result":`)
+	} else {
+		raw = []byte(`{"jsonrpc":"2.0","id":"` + id + `","result":`)
+	}
+	raw = append(raw, result...)
+	return append(raw, '}')
+}
+
+// keep stores the response of a cacheable call if it can not change anymore
+func (p *Provider) keep(key string, rule Rule, block int64, raw []byte) {
+	resp, err := jsonrpc2.DecodeResponse(raw)
+	if err != nil || resp.Error != nil || len(resp.Result) == 0 || string(resp.Result) == "null" {
+		return
+	}
+
+	if rule.ResultBlock {
+		var ok bool
+		block, ok = resultBlock(resp.Result)
+		if !ok {
+			return
+		}
+	}
+	if block >= 0 && !p.final(block) {
+		return
+	}
+
+	// a failing store only costs a refetch later, the id is given anew to every hit
+	p.store.Set(key, response("", resp.Result))
+}
+
+// Call calls a RPC method, answering from the cache when possible
+func (p *Provider) Call(result interface{}, method string, params ...interface{}) error {
+	if _, ok := p.rules[method]; !ok {
+		return p.next.Call(result, method, params...)
+	}
+
+	raw, err := p.CallRaw(method, params...)
+	if err != nil {
+		return err
+	}
+
+	return provider.Decode(raw, result)
+}
+
+// Subscribe creates a subscription on the wrapped provider, notifications are not cached
+func (p *Provider) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	return p.next.Subscribe(receiver, method, event, params...)
+}
+
+// SubscribeErr passes the subscription through, see provider.ErrSubscriber
+func (p *Provider) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	return provider.SubscribeErr(p.next, receiver, errs, method, event, params...)
+}
+
+// Key returns the store key of a call, see jsonrpc2.RequestKey
+func Key(method string, params []interface{}) (string, error) {
+	return jsonrpc2.RequestKey(method, params)
+}
+
+func (p *Provider) count(hit bool) {
+	p.mu.Lock()
+	if hit {
+		p.hits++
+	} else {
+		p.misses++
+	}
+	p.mu.Unlock()
+}
+
+// final returns true if block is at least depth blocks below the head
+func (p *Provider) final(block int64) bool {
+	head, err := p.headBlock()
+	if err != nil {
+		return false
+	}
+	return block <= head-p.depth
+}
+
+// headBlock returns the head block number, asking the node when the known one is too old
+func (p *Provider) headBlock() (int64, error) {
+	p.mu.Lock()
+	if !p.headTime.IsZero() && time.Since(p.headTime) < p.headTTL {
+		head := p.head
+		p.mu.Unlock()
+		return head, nil
+	}
+	p.mu.Unlock()
+
+	var n string
+	if err := p.next.Call(&n, "eth_blockNumber"); err != nil {
+		return 0, err
+	}
+	head, err := strconv.ParseInt(n, 0, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	p.head = head
+	p.headTime = time.Now()
+	p.mu.Unlock()
+	return head, nil
+}
+
+// resultBlock reads the blockNumber field of a result, it is null for pending transactions
+func resultBlock(result json.RawMessage) (int64, bool) {
+	var r struct {
+		BlockNumber *string `json:"blockNumber"`
+	}
+	if err := json.Unmarshal(result, &r); err != nil || r.BlockNumber == nil {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(*r.BlockNumber, 0, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/etherr"
+)
+
+// node is at block 100 and counts the calls per method
+type node struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (n *node) Start() error { return nil }
+func (n *node) Stop()        {}
+func (n *node) Call(result interface{}, method string, params ...interface{}) error {
+	n.count(method)
+	*result.(*string) = "0x64"
+	return nil
+}
+func (n *node) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	n.count(method)
+	switch method {
+	case "eth_getTransactionReceipt":
+		if params[0] == "0xpending" {
+			return []byte(`{"jsonrpc":"2.0","id":"1","result":{"blockNumber":null}}`), nil
+		}
+		return []byte(`{"jsonrpc":"2.0","id":"1","result":{"blockNumber":"0x50"}}`), nil
+	case "eth_getCode":
+		return []byte(`{"jsonrpc":"2.0","id":"1","error":{"code":-32000,"message":"missing trie node"}}`), nil
+	case "eth_getBlockByHash":
+		return []byte(`{"jsonrpc":"2.0","id":"1","result":null}`), nil
+	}
+	return []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":"1","result":%q}`, params[0])), nil
+}
+func (n *node) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	return nil
+}
+func (n *node) count(method string) {
+	n.mu.Lock()
+	n.calls[method]++
+	n.mu.Unlock()
+}
+
+func TestProvider_Call(t *testing.T) {
+	var tests = map[string]struct {
+		method string
+		params []interface{}
+		cached bool
+	}{
+		"final block":       {"eth_getBlockByNumber", []interface{}{"0x10", false}, true},
+		"recent block":      {"eth_getBlockByNumber", []interface{}{"0x60", false}, false},
+		"latest":            {"eth_getBlockByNumber", []interface{}{"latest", false}, false},
+		"pending":           {"eth_getBalance", []interface{}{"0x0", "pending"}, false},
+		"mined receipt":     {"eth_getTransactionReceipt", []interface{}{"0xmined"}, true},
+		"pending receipt":   {"eth_getTransactionReceipt", []interface{}{"0xpending"}, false},
+		"error":             {"eth_getCode", []interface{}{"0x0", "0x10"}, false},
+		"null":              {"eth_getBlockByHash", []interface{}{"0xunknown", false}, false},
+		"not cacheable":     {"eth_gasPrice", []interface{}{"0x1"}, false},
+		"immutable by hash": {"eth_getUncleByBlockHashAndIndex", []interface{}{"0xhash", "0x0"}, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			n := &node{calls: make(map[string]int)}
+			store, err := NewMemoryStore(1 << 20)
+			assert.NoError(t, err)
+			p, err := New(n, store, nil, DefaultDepth)
+			assert.NoError(t, err)
+
+			for i := 0; i < 2; i++ {
+				_, err := p.CallRaw(tt.method, tt.params...)
+				assert.NoError(t, err)
+			}
+
+			expected := 2
+			if tt.cached {
+				expected = 1
+			}
+			assert.Equal(t, expected, n.calls[tt.method])
+		})
+	}
+}
+
+func TestProvider_CallRawID(t *testing.T) {
+	n := &node{calls: make(map[string]int)}
+	store, err := NewMemoryStore(1 << 20)
+	assert.NoError(t, err)
+	p, err := New(n, store, nil, DefaultDepth)
+	assert.NoError(t, err)
+
+	_, err = p.CallRaw("eth_getBlockByNumber", "0x10", false)
+	assert.NoError(t, err)
+	key, err := Key("eth_getBlockByNumber", []interface{}{"0x10", false})
+	assert.NoError(t, err)
+	stored, ok := store.Get(key)
+	assert.True(t, ok)
+	assert.NotContains(t, string(stored), `"id"`)
+
+	// every hit gets an id of its own, not the one of the request which filled the cache
+	first, err := p.CallRaw("eth_getBlockByNumber", "0x10", false)
+	assert.NoError(t, err)
+	second, err := p.CallRaw("eth_getBlockByNumber", "0x10", false)
+	assert.NoError(t, err)
+	var a, b struct {
+		ID     string
+		Result string
+	}
+	assert.NoError(t, json.Unmarshal(first, &a))
+	assert.NoError(t, json.Unmarshal(second, &b))
+	assert.NotEqual(t, "1", a.ID)
+	assert.NotEqual(t, a.ID, b.ID)
+	assert.Equal(t, "0x10", b.Result)
+	assert.Equal(t, 1, n.calls["eth_getBlockByNumber"])
+}
+
+func TestProvider_CallDecodes(t *testing.T) {
+	n := &node{calls: make(map[string]int)}
+	store, err := NewMemoryStore(1 << 20)
+	assert.NoError(t, err)
+	p, err := New(n, store, nil, DefaultDepth)
+	assert.NoError(t, err)
+
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_getBlockByNumber", "0x10", false))
+	assert.NoError(t, p.Call(&result, "eth_getBlockByNumber", "0x10", false))
+	assert.Equal(t, "0x10", result)
+	assert.Equal(t, 1, n.calls["eth_getBlockByNumber"])
+
+	hits, misses := p.Stats()
+	assert.Equal(t, int64(1), hits)
+	assert.Equal(t, int64(1), misses)
+
+	assert.Equal(t, etherr.Nil, p.Call(&result, "eth_getBlockByHash", "0xunknown", false))
+}
+
+func TestMemoryStore_Evict(t *testing.T) {
+	s, err := NewMemoryStore(10)
+	assert.NoError(t, err)
+
+	s.Set("a", []byte("1234"))
+	s.Set("b", []byte("1234"))
+	s.Get("a")
+	s.Set("c", []byte("1234"))
+
+	_, ok := s.Get("b")
+	assert.False(t, ok)
+	_, ok = s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, s.Len())
+
+	s.Set("d", []byte("too big for the store"))
+	_, ok = s.Get("d")
+	assert.False(t, ok)
+}
+
+func TestDiskStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewDiskStore(dir)
+	assert.NoError(t, err)
+
+	key, err := Key("trace_block", []interface{}{"0x10"})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Set(key, []byte(`{"result":[]}`)))
+
+	value, ok := s.Get(key)
+	assert.True(t, ok)
+	assert.Equal(t, `{"result":[]}`, string(value))
+
+	files, err := ioutil.ReadDir(dir + "/trace_block")
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
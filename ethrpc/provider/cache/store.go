@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store keeps the cached responses
+type Store interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte) error
+}
+
+// MemoryStore is an in memory least recently used store bounded by the size of the values
+type MemoryStore struct {
+	maxSize int
+	size    int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryStore creates a memory store holding at most maxSize bytes of responses
+func NewMemoryStore(maxSize int) (*MemoryStore, error) {
+	if maxSize < 1 {
+		return nil, fmt.Errorf("Maximum cache size must be positive")
+	}
+
+	return &MemoryStore{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}, nil
+}
+
+// Get returns the value stored under key and marks it as recently used
+func (s *MemoryStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.order.MoveToFront(e)
+	return e.Value.(*memoryEntry).value, true
+}
+
+// Set stores value under key, evicting the least recently used values when full.
+// Values bigger than the whole store are not kept.
+func (s *MemoryStore) Set(key string, value []byte) error {
+	if len(value) > s.maxSize {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		s.size -= len(e.Value.(*memoryEntry).value)
+		s.order.Remove(e)
+	}
+
+	s.entries[key] = s.order.PushFront(&memoryEntry{key, value})
+	s.size += len(value)
+
+	for s.size > s.maxSize {
+		e := s.order.Back()
+		entry := e.Value.(*memoryEntry)
+		s.order.Remove(e)
+		delete(s.entries, entry.key)
+		s.size -= len(entry.value)
+	}
+	return nil
+}
+
+// Len returns the number of values in the store
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// DiskStore keeps every value in its own file, under a directory per method
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore creates a disk store in dir, creating it if needed
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+// Get reads the value stored under key
+func (s *DiskStore) Get(key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Set writes the value under key. The file is renamed into place so readers
+// never see it half written.
+func (s *DiskStore) Set(key string, value []byte) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// path returns dir/method/sha256(key).json, keys start with the method name
+func (s *DiskStore) path(key string) string {
+	method := key
+	if i := strings.IndexByte(key, ' '); i >= 0 {
+		method = key[:i]
+	}
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, method, hex.EncodeToString(sum[:])+".json")
+}
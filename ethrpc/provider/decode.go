@@ -0,0 +1,40 @@
+package provider
+
+import (
+	"encoding/json"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/jsonrpc2"
+)
+
+// DecodeResult unmarshals the result of a json rpc response, turning null results
+// and json rpc errors into the matching etherr errors
+func DecodeResult(resp *jsonrpc2.JSONRPCMessage, result interface{}) error {
+	null := string(json.RawMessage([]byte("null")))
+	if string(resp.Result) == null {
+		return etherr.Nil
+	}
+
+	if resp.Error != nil {
+		switch resp.Error.Code {
+		case -32015: // VM execution error
+			err := etherr.VMExecutionError.(*etherr.RpcError)
+			err.Code = resp.Error.Code
+			err.Details = resp.Error.Data
+			return err
+		default:
+			return etherr.New(resp.Error.Message, resp.Error.Code, resp.Error.Data)
+		}
+	}
+
+	return json.Unmarshal(resp.Result, &result)
+}
+
+// Decode decodes a raw json rpc response into result, see DecodeResult
+func Decode(raw []byte, result interface{}) error {
+	resp, err := jsonrpc2.DecodeResponse(raw)
+	if err != nil {
+		return err
+	}
+	return DecodeResult(resp, result)
+}
@@ -0,0 +1,185 @@
+package provider
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/alethio/web3-go/etherr"
+)
+
+// DefaultMaxQueued is the default number of notifications a subscription queues for its
+// receiver before it is ended
+const DefaultMaxQueued = 10000
+
+// Deliver hands n to receiver, giving up when ended is closed
+type Deliver func(receiver chan *json.RawMessage, n *json.RawMessage, ended chan struct{})
+
+// Delivery hands the notifications of a subscription to its receiver and its errors to
+// errs, in order, from a goroutine of its own: the reader of a connection queues them
+// without ever waiting for the subscriber, so the responses to calls and the other
+// subscriptions are not held back by a receiver that is not drained. Such a subscription
+// ends with etherr.SubscriptionOverflow once its queue is full.
+type Delivery struct {
+	receiver chan *json.RawMessage
+	errs     chan error
+	deliver  Deliver
+	max      int
+
+	mu    sync.Mutex
+	queue []queued
+	// queued is the number of notifications in the queue
+	queued int
+	// holding is set while a notification taken from the queue waits for the receiver
+	holding bool
+	wake    chan struct{}
+	ended   chan struct{}
+	closed  bool
+}
+
+// queued is a notification, an error, or the end of the subscription with its cause
+type queued struct {
+	n   *json.RawMessage
+	err error
+	end bool
+}
+
+// NewDelivery starts delivering to receiver and errs with deliver, nil deliver waits
+// for the subscriber until the subscription ends. At most max notifications wait in the
+// queue, DefaultMaxQueued when max is not positive.
+func NewDelivery(receiver chan *json.RawMessage, errs chan error, deliver Deliver, max int) *Delivery {
+	if deliver == nil {
+		deliver = func(receiver chan *json.RawMessage, n *json.RawMessage, ended chan struct{}) {
+			select {
+			case receiver <- n:
+			case <-ended:
+			}
+		}
+	}
+
+	if max <= 0 {
+		max = DefaultMaxQueued
+	}
+
+	d := &Delivery{
+		receiver: receiver,
+		errs:     errs,
+		deliver:  deliver,
+		max:      max,
+		wake:     make(chan struct{}, 1),
+		ended:    make(chan struct{}),
+	}
+	go d.loop()
+	return d
+}
+
+// Notify queues a notification. It returns false when the queue is full: the subscription
+// is then ended with etherr.SubscriptionOverflow, like by End.
+func (d *Delivery) Notify(n *json.RawMessage) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return true
+	}
+	if d.queued >= d.max {
+		d.end(etherr.SubscriptionOverflow)
+		return false
+	}
+	d.queued++
+	d.queue = append(d.queue, queued{n: n})
+	d.signal()
+	return true
+}
+
+// Err queues an error, it is sent to errs once the notifications before it are delivered
+func (d *Delivery) Err(err error) {
+	d.push(queued{err: err})
+}
+
+// End ends the subscription: the notifications queued are only delivered if the receiver
+// has room, then errs gets the cause and the receiver is closed. Only the first call counts.
+func (d *Delivery) End(cause error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closed {
+		d.end(cause)
+	}
+}
+
+// end queues the end of the subscription, d.mu must be held
+func (d *Delivery) end(cause error) {
+	d.closed = true
+	close(d.ended)
+	d.queue = append(d.queue, queued{err: cause, end: true})
+	d.signal()
+}
+
+// Len returns the number of notifications waiting, in the queue and in the receiver
+func (d *Delivery) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := len(d.receiver) + d.queued
+	if d.holding {
+		n++
+	}
+	return n
+}
+
+func (d *Delivery) push(q queued) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	d.queue = append(d.queue, q)
+	d.signal()
+}
+
+// signal wakes the loop up, d.mu must be held
+func (d *Delivery) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Delivery) loop() {
+	for range d.wake {
+		for {
+			d.mu.Lock()
+			if len(d.queue) == 0 {
+				d.mu.Unlock()
+				break
+			}
+			q := d.queue[0]
+			d.queue[0] = queued{}
+			d.queue = d.queue[1:]
+			d.holding = q.n != nil
+			if d.holding {
+				d.queued--
+			}
+			d.mu.Unlock()
+
+			switch {
+			case q.end:
+				SendErr(d.errs, q.err)
+				close(d.receiver)
+				return
+			case q.n == nil:
+				SendErr(d.errs, q.err)
+			default:
+				select {
+				case <-d.ended:
+					select {
+					case d.receiver <- q.n:
+					default:
+					}
+				default:
+					d.deliver(d.receiver, q.n, d.ended)
+				}
+				d.mu.Lock()
+				d.holding = false
+				d.mu.Unlock()
+			}
+		}
+	}
+}
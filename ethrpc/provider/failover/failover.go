@@ -0,0 +1,436 @@
+// Package failover sends the calls to the first healthy of several providers, moving on
+// to the next endpoint when one fails or does not answer in time
+package failover
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/ethrpc/provider/retry"
+)
+
+const (
+	// DefaultTimeout is the default time an endpoint has to answer a call
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultCooldown is the default time a failed endpoint is left alone
+	DefaultCooldown = 30 * time.Second
+)
+
+// ErrTimeout is returned when an endpoint did not answer in time
+var ErrTimeout = fmt.Errorf("failover: call timed out")
+
+// Status describes the health of an endpoint
+type Status struct {
+	Healthy   bool
+	Failures  int
+	LastError error
+}
+
+type endpoint struct {
+	provider   provider.Interface
+	failures   int
+	lastError  error
+	downUntil  time.Time
+	restarting bool
+}
+
+// Provider sends every call to the first healthy endpoint, in the order they were given
+type Provider struct {
+	endpoints []*endpoint
+	timeout   time.Duration
+	cooldown  time.Duration
+
+	mu      sync.Mutex
+	stop    chan struct{}
+	stopped bool
+}
+
+type subscription struct {
+	receiver chan *json.RawMessage
+	errs     chan error
+	method   string
+	event    string
+	params   []interface{}
+}
+
+// New creates a failover provider over the given endpoints. Each call gets timeout
+// to complete, 0 disables it; failed endpoints are skipped during cooldown.
+func New(timeout, cooldown time.Duration, providers ...provider.Interface) (*Provider, error) {
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("At least one provider is needed")
+	}
+
+	p := &Provider{
+		timeout:  timeout,
+		cooldown: cooldown,
+		stop:     make(chan struct{}),
+	}
+	for _, e := range providers {
+		p.endpoints = append(p.endpoints, &endpoint{provider: e})
+	}
+	return p, nil
+}
+
+// Start starts all endpoints, it only fails if none of them could be started
+func (p *Provider) Start() error {
+	var err error
+	started := 0
+	for i, e := range p.endpoints {
+		if startErr := e.provider.Start(); startErr != nil {
+			err = startErr
+			p.failed(i, startErr)
+			continue
+		}
+		started++
+	}
+
+	if started == 0 {
+		return fmt.Errorf("no endpoint could be started: %s", err)
+	}
+	return nil
+}
+
+// Stop stops all endpoints and closes the subscriptions
+func (p *Provider) Stop() {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.stop)
+	}
+	p.mu.Unlock()
+
+	for _, e := range p.endpoints {
+		e.provider.Stop()
+	}
+}
+
+// Status returns the health of the endpoints, in the order they were given
+func (p *Provider) Status() []Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	s := make([]Status, len(p.endpoints))
+	for i, e := range p.endpoints {
+		s[i] = Status{
+			Healthy:   now.After(e.downUntil),
+			Failures:  e.failures,
+			LastError: e.lastError,
+		}
+	}
+	return s
+}
+
+// CallRaw calls a RPC method on the first endpoint able to answer
+func (p *Provider) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	// a timed out call might still complete later, so every attempt gets its own result
+	var first answer
+	err := p.do(method, func(e provider.Interface) error {
+		raw, err := e.CallRaw(method, params...)
+		if err == nil {
+			first.keep(raw)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return first.get().([]byte), nil
+}
+
+// Call calls a RPC method on the first endpoint able to answer
+func (p *Provider) Call(result interface{}, method string, params ...interface{}) error {
+	var first answer
+	err := p.do(method, func(e provider.Interface) error {
+		var r json.RawMessage
+		err := e.Call(&r, method, params...)
+		if err == nil {
+			first.keep(r)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(first.get().(json.RawMessage), result)
+}
+
+// CallBatch sends the batch to the first endpoint able to answer it
+func (p *Provider) CallBatch(batch []*provider.BatchElem) error {
+	// a transaction in the batch makes it as unsafe to send twice
+	method := ""
+	for _, elem := range batch {
+		if !provider.IsIdempotent(elem.Method) {
+			method = elem.Method
+		}
+	}
+
+	var first answer
+	err := p.do(method, func(e provider.Interface) error {
+		attempt := make([]*provider.BatchElem, len(batch))
+		for i, elem := range batch {
+			attempt[i] = &provider.BatchElem{Method: elem.Method, Params: elem.Params, Result: new(json.RawMessage)}
+		}
+		err := provider.CallBatch(e, attempt)
+		if err == nil {
+			first.keep(attempt)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	answered := first.get().([]*provider.BatchElem)
+	for i, elem := range batch {
+		elem.Raw, elem.Error = answered[i].Raw, answered[i].Error
+		if elem.Error == nil {
+			elem.Error = json.Unmarshal(*answered[i].Result.(*json.RawMessage), elem.Result)
+		}
+	}
+	return nil
+}
+
+// answer keeps the first successful result of the attempts of a call. A timed out attempt
+// goes on in the background and may succeed at any time, even after the call returned.
+type answer struct {
+	mu    sync.Mutex
+	value interface{}
+}
+
+func (a *answer) keep(v interface{}) {
+	a.mu.Lock()
+	if a.value == nil {
+		a.value = v
+	}
+	a.mu.Unlock()
+}
+
+func (a *answer) get() interface{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.value
+}
+
+// Subscribe creates the subscription on the first endpoint supporting it. When that
+// endpoint dies the subscription is made again on the next one; notifications sent
+// in between are lost. The receiver is closed when the provider is stopped.
+func (p *Provider) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	return p.SubscribeErr(receiver, nil, method, event, params...)
+}
+
+// SubscribeErr is Subscribe with errs receiving the errors of the endpoints, among them
+// the cause of the end of the subscription on an endpoint before it moves to the next
+// one, see provider.ErrSubscriber. A subscription ended by the endpoint for another
+// reason than the loss of its connection, like an overflow, ends with that cause.
+func (p *Provider) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	s := &subscription{
+		receiver: receiver,
+		errs:     errs,
+		method:   method,
+		event:    event,
+		params:   params,
+	}
+
+	in, inErrs, i, err := p.subscribe(s)
+	if err != nil {
+		return err
+	}
+
+	go p.forward(s, in, inErrs, i)
+	return nil
+}
+
+// forward moves notifications and errors to the subscriber, resubscribing whenever the
+// endpoint dies
+func (p *Provider) forward(s *subscription, in chan *json.RawMessage, inErrs chan error, i int) {
+	defer close(s.receiver)
+
+	// the last error of the endpoint, the one sent before the end is its cause
+	var last error
+	for {
+		select {
+		case n, ok := <-in:
+			if ok {
+				select {
+				case s.receiver <- n:
+				case <-p.stop:
+					provider.SendErr(s.errs, etherr.ConnectionClosed)
+					return
+				}
+				continue
+			}
+		case err := <-inErrs:
+			provider.SendErr(s.errs, err)
+			last = err
+			continue
+		case <-p.stop:
+			provider.SendErr(s.errs, etherr.ConnectionClosed)
+			return
+		}
+
+		// the endpoint closed the subscription, its cause was sent before
+		for drained := false; !drained; {
+			select {
+			case err := <-inErrs:
+				provider.SendErr(s.errs, err)
+				last = err
+			default:
+				drained = true
+			}
+		}
+		cause := last
+		last = nil
+		// endpoints which can not tell why are taken as dead
+		if cause == nil {
+			cause = etherr.ConnectionClosed
+		}
+		if !etherr.IsConnectionLoss(cause) {
+			return
+		}
+		p.failed(i, cause)
+
+		for {
+			var err error
+			// the dead endpoint is now last in line, it is only used again once restarted
+			in, inErrs, i, err = p.subscribe(s)
+			if err == nil {
+				break
+			}
+
+			select {
+			case <-time.After(p.cooldown):
+			case <-p.stop:
+				provider.SendErr(s.errs, etherr.ConnectionClosed)
+				return
+			}
+		}
+	}
+}
+
+// subscribe makes the subscription on the first endpoint accepting it, the errors of
+// the endpoint tell why it ends
+func (p *Provider) subscribe(s *subscription) (chan *json.RawMessage, chan error, int, error) {
+	var err error
+	for _, i := range p.order() {
+		in := make(chan *json.RawMessage, cap(s.receiver))
+		inErrs := make(chan error, cap(s.errs)+1)
+		err = provider.SubscribeErr(p.endpoints[i].provider, in, inErrs, s.method, s.event, s.params...)
+		if err == nil {
+			return in, inErrs, i, nil
+		}
+	}
+
+	if err == nil {
+		err = fmt.Errorf("no endpoint available")
+	}
+	return nil, nil, -1, fmt.Errorf("failover subscription: %s", err)
+}
+
+// do runs the call of method on the endpoints until one of them gives an answer. Errors
+// which are the answer to the call, like execution errors, are returned right away, so
+// are those of a transaction which may have reached the node.
+func (p *Provider) do(method string, call func(e provider.Interface) error) error {
+	var err error
+	for _, i := range p.order() {
+		err = p.call(p.endpoints[i].provider, call)
+		if err == nil {
+			p.succeeded(i)
+			return nil
+		}
+		if err != ErrTimeout && !retry.IsRetryable(err) {
+			return err
+		}
+		p.failed(i, err)
+		// a timed out endpoint may still send the transaction
+		if !provider.IsIdempotent(method) && (err == ErrTimeout || !retry.IsRetryableCall(method, err)) {
+			return err
+		}
+	}
+	return err
+}
+
+func (p *Provider) call(e provider.Interface, call func(e provider.Interface) error) error {
+	if p.timeout <= 0 {
+		return call(e)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- call(e)
+	}()
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrTimeout
+	}
+}
+
+// order returns the endpoints to try: the healthy ones first, then the rest
+func (p *Provider) order() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var healthy, down []int
+	for i, e := range p.endpoints {
+		if now.After(e.downUntil) {
+			healthy = append(healthy, i)
+		} else {
+			down = append(down, i)
+		}
+	}
+	return append(healthy, down...)
+}
+
+func (p *Provider) succeeded(i int) {
+	p.mu.Lock()
+	e := p.endpoints[i]
+	e.failures = 0
+	e.downUntil = time.Time{}
+	p.mu.Unlock()
+}
+
+func (p *Provider) failed(i int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e := p.endpoints[i]
+	e.failures++
+	e.lastError = err
+	e.downUntil = time.Now().Add(p.cooldown)
+
+	// a dead websocket needs a new connection before it can be used again
+	if etherr.IsConnectionLoss(err) && !e.restarting && !p.stopped {
+		e.restarting = true
+		go p.restart(e)
+	}
+}
+
+func (p *Provider) restart(e *endpoint) {
+	select {
+	case <-time.After(p.cooldown):
+	case <-p.stop:
+		return
+	}
+
+	err := e.provider.Start()
+
+	p.mu.Lock()
+	e.restarting = false
+	if err != nil {
+		e.lastError = err
+	}
+	p.mu.Unlock()
+}
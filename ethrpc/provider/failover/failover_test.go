@@ -0,0 +1,300 @@
+package failover
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/ethrpc/provider/wsrpc"
+	"github.com/alethio/web3-go/rpctest"
+)
+
+func httpEndpoint(t *testing.T, status int, result string) (provider.Interface, func()) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		var req struct{ ID string }
+		json.NewDecoder(r.Body).Decode(&req)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"%s","result":%s}`, req.ID, result)
+	}))
+
+	p, err := httprpc.New(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, srv.Close
+}
+
+// stub only supports subscriptions, which can be killed from the test
+type stub struct {
+	mu        sync.Mutex
+	receivers []chan *json.RawMessage
+	errs      []chan error
+}
+
+func (s *stub) Start() error { return nil }
+func (s *stub) Stop()        {}
+func (s *stub) Call(result interface{}, method string, params ...interface{}) error {
+	return fmt.Errorf("not implemented")
+}
+func (s *stub) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+func (s *stub) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	s.mu.Lock()
+	s.receivers = append(s.receivers, receiver)
+	s.mu.Unlock()
+	return nil
+}
+func (s *stub) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	s.mu.Lock()
+	s.errs = append(s.errs, errs)
+	s.mu.Unlock()
+	return s.Subscribe(receiver, method, event, params...)
+}
+func (s *stub) fail(err error) {
+	s.mu.Lock()
+	errs := s.errs[len(s.errs)-1]
+	s.mu.Unlock()
+	provider.SendErr(errs, err)
+}
+func (s *stub) subscriptions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.receivers)
+}
+func (s *stub) notify(msg string) {
+	s.mu.Lock()
+	r := s.receivers[len(s.receivers)-1]
+	s.mu.Unlock()
+	m := json.RawMessage(msg)
+	r <- &m
+}
+func (s *stub) kill() {
+	s.mu.Lock()
+	close(s.receivers[len(s.receivers)-1])
+	s.mu.Unlock()
+}
+
+func TestProvider_Call(t *testing.T) {
+	down, closeDown := httpEndpoint(t, http.StatusServiceUnavailable, "")
+	defer closeDown()
+	up, closeUp := httpEndpoint(t, http.StatusOK, `"0x10"`)
+	defer closeUp()
+
+	p, err := New(time.Second, time.Minute, down, up)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, "0x10", result)
+
+	status := p.Status()
+	assert.False(t, status[0].Healthy)
+	assert.Equal(t, 1, status[0].Failures)
+	assert.True(t, status[1].Healthy)
+
+	// the failed endpoint is not asked again during the cooldown
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, 1, p.Status()[0].Failures)
+}
+
+// late answers after a delay, whatever the deadline of the caller
+type late struct {
+	stub
+	delay  time.Duration
+	result string
+}
+
+func (l *late) Call(result interface{}, method string, params ...interface{}) error {
+	time.Sleep(l.delay)
+	return json.Unmarshal([]byte(l.result), result)
+}
+func (l *late) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	time.Sleep(l.delay)
+	return []byte(`{"jsonrpc":"2.0","id":"1","result":` + l.result + `}`), nil
+}
+
+func TestProvider_LateAnswer(t *testing.T) {
+	slow := &late{delay: 60 * time.Millisecond, result: `"0x1"`}
+	fast := &late{result: `"0x2"`}
+
+	// the slow endpoint is tried first every time, its cooldown is over right away
+	p, err := New(30*time.Millisecond, time.Nanosecond, slow, fast)
+	assert.NoError(t, err)
+
+	raw, err := p.CallRaw("eth_blockNumber")
+	assert.NoError(t, err)
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+
+	// the timed out attempts answer once the calls returned, the answers stay the second's
+	time.Sleep(100 * time.Millisecond)
+	assert.Contains(t, string(raw), `"0x2"`)
+	assert.Equal(t, "0x2", result)
+}
+
+func TestProvider_WSTimeout(t *testing.T) {
+	slowSrv, fastSrv := rpctest.NewServer(), rpctest.NewServer()
+	defer slowSrv.Close()
+	defer fastSrv.Close()
+	for _, srv := range []*rpctest.Server{slowSrv, fastSrv} {
+		srv.Handle("eth_blockNumber", "0x10")
+		srv.Handle("eth_sendRawTransaction", "0xdead")
+	}
+	slowSrv.SetLatency(100 * time.Millisecond)
+
+	slow, err := wsrpc.New(slowSrv.WSURL, false, wsrpc.WithCallTimeout(30*time.Millisecond))
+	assert.NoError(t, err)
+	fast, err := wsrpc.New(fastSrv.WSURL, false)
+	assert.NoError(t, err)
+	p, err := New(time.Second, time.Nanosecond, slow, fast)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	// the websocket gave up on the call, the next endpoint answers
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, "0x10", result)
+	assert.Equal(t, etherr.RequestTimeout, p.Status()[0].LastError)
+
+	// the transaction may have reached the first node, it is not sent to the second
+	assert.Equal(t, etherr.RequestTimeout, p.Call(&result, "eth_sendRawTransaction", "0x00"))
+	assert.Equal(t, 0, fastSrv.Count("eth_sendRawTransaction"))
+}
+
+func TestProvider_SubscriptionOverflow(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	ws, err := wsrpc.New(srv.WSURL, false, wsrpc.WithOverflowPolicy(wsrpc.Terminate))
+	assert.NoError(t, err)
+	p, err := New(time.Second, time.Minute, ws, &stub{})
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	receiver := make(chan *json.RawMessage)
+	errs := make(chan error, 1)
+	assert.NoError(t, p.SubscribeErr(receiver, errs, "eth_subscribe", "newHeads"))
+	for i := 0; i < 2; i++ {
+		_, err := srv.Notify("newHeads", i)
+		assert.NoError(t, err)
+	}
+
+	// the first one waits in the failover, the second one overflows
+	assert.Equal(t, `0`, string(*<-receiver))
+
+	// the endpoint ended the subscription, it did not die
+	select {
+	case err := <-errs:
+		assert.Equal(t, etherr.SubscriptionOverflow, err)
+	case <-time.After(time.Second):
+		t.Fatal("subscription not ended")
+	}
+	_, ok := <-receiver
+	assert.False(t, ok)
+	assert.True(t, p.Status()[0].Healthy)
+	assert.Equal(t, 0, ws.Stats().Reconnects)
+}
+
+func TestProvider_Transaction(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	first, err := httprpc.New(slow.URL)
+	assert.NoError(t, err)
+	second, closeSecond := httpEndpoint(t, http.StatusOK, `"0x10"`)
+	defer closeSecond()
+
+	p, err := New(50*time.Millisecond, time.Minute, first, second)
+	assert.NoError(t, err)
+
+	// the first endpoint may still send it, the transaction is not sent twice
+	var hash string
+	assert.Equal(t, ErrTimeout, p.Call(&hash, "eth_sendRawTransaction", "0x00"))
+	assert.Equal(t, "", hash)
+	assert.False(t, p.Status()[0].Healthy)
+
+	// the next one goes to the healthy endpoint
+	assert.NoError(t, p.Call(&hash, "eth_sendRawTransaction", "0x00"))
+	assert.Equal(t, "0x10", hash)
+}
+
+func TestProvider_Subscribe(t *testing.T) {
+	first, second := &stub{}, &stub{}
+	p, err := New(time.Second, time.Minute, first, second)
+	assert.NoError(t, err)
+
+	receiver := make(chan *json.RawMessage, 1)
+	assert.NoError(t, p.Subscribe(receiver, "eth_subscribe", "newHeads"))
+
+	first.notify(`1`)
+	assert.Equal(t, `1`, string(*<-receiver))
+
+	first.kill()
+	for i := 0; second.subscriptions() != 1; i++ {
+		if i == 1000 {
+			t.Fatal("subscription not moved to the second endpoint")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	second.notify(`2`)
+	assert.Equal(t, `2`, string(*<-receiver))
+
+	p.Stop()
+	_, ok := <-receiver
+	assert.False(t, ok)
+}
+
+func TestProvider_SubscribeErr(t *testing.T) {
+	first, second := &stub{}, &stub{}
+	p, err := New(time.Second, time.Minute, first, second)
+	assert.NoError(t, err)
+
+	receiver := make(chan *json.RawMessage, 1)
+	errs := make(chan error, 4)
+	assert.NoError(t, p.SubscribeErr(receiver, errs, "eth_subscribe", "newHeads"))
+
+	// errors of the node are passed on
+	first.fail(etherr.New("filter not found", -32000, ""))
+	err = <-errs
+	if assert.IsType(t, &etherr.RpcError{}, err) {
+		assert.Equal(t, -32000, err.(*etherr.RpcError).Code)
+	}
+
+	// so is the cause of the end of the subscription on the dead endpoint
+	first.fail(etherr.ConnectionLost(fmt.Errorf("reset")))
+	first.kill()
+	for i := 0; second.subscriptions() != 1; i++ {
+		if i == 1000 {
+			t.Fatal("subscription not moved to the second endpoint")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Error(t, <-errs)
+
+	second.notify(`2`)
+	assert.Equal(t, `2`, string(*<-receiver))
+
+	p.Stop()
+	_, ok := <-receiver
+	assert.False(t, ok)
+	assert.Equal(t, etherr.ConnectionClosed, <-errs)
+}
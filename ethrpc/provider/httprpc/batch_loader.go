@@ -3,9 +3,13 @@ package httprpc
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
 	"github.com/alethio/web3-go/jsonrpc2"
 )
 
@@ -20,8 +24,11 @@ func NewBatchLoader(maxBatch int, wait time.Duration) (*BatchLoader, error) {
 	}
 
 	return &BatchLoader{
-		wait:     wait,
-		maxBatch: maxBatch,
+		wait:        wait,
+		maxBatch:    maxBatch,
+		deduplicate: true,
+		tooLarge:    IsBatchTooLarge,
+		since:       time.Since,
 	}, nil
 }
 
@@ -41,6 +48,28 @@ type BatchLoader struct {
 	// this will limit the maximum number of keys to send in one batch, 0 = no limit
 	maxBatch int
 
+	// called with the size of every batch before it is sent
+	observe func(size int)
+
+	// identical requests of a batch are sent once
+	deduplicate bool
+
+	// tells if the error of a batch is the node refusing it because of its size
+	tooLarge func(err error) bool
+
+	// measures the response times of the adaptive sizing
+	since func(t time.Time) time.Duration
+
+	// slots of the batches allowed in flight at once, nil = no limit
+	slots chan struct{}
+
+	// adaptive sizing keeps maxBatch between minBatch and adaptiveMax, growing it while
+	// full batches are answered within target and halving it when they are not
+	adaptive    bool
+	minBatch    int
+	adaptiveMax int
+	target      time.Duration
+
 	// INTERNAL
 
 	// the current batch. keys will continue to be collected until timeout is hit,
@@ -53,12 +82,107 @@ type BatchLoader struct {
 
 type batchLoaderBatch struct {
 	requests []*jsonrpc2.JSONRPCRequest
+	keys     map[string]int
 	data     [][]byte
 	error    []error
 	closing  bool
 	done     chan struct{}
 }
 
+// SetBatchObserver sets a function called with the size of every batch before it is sent
+func (l *BatchLoader) SetBatchObserver(observe func(size int)) {
+	l.mu.Lock()
+	l.observe = observe
+	l.mu.Unlock()
+}
+
+// SetDeduplication enables or disables sending identical requests of a batch only once,
+// it is enabled by default
+func (l *BatchLoader) SetDeduplication(enabled bool) {
+	l.mu.Lock()
+	l.deduplicate = enabled
+	l.mu.Unlock()
+}
+
+// SetBatchTooLarge sets the function telling if the error of a batch is the node refusing
+// it because of its size, those batches are split. IsBatchTooLarge by default.
+func (l *BatchLoader) SetBatchTooLarge(tooLarge func(err error) bool) {
+	l.mu.Lock()
+	l.tooLarge = tooLarge
+	l.mu.Unlock()
+}
+
+// SetMaxConcurrentBatches limits the number of batches in flight, the next ones wait
+// for a slot. 0 removes the limit.
+func (l *BatchLoader) SetMaxConcurrentBatches(n int) error {
+	if n < 0 {
+		return fmt.Errorf("Maximum concurrent batches can not be negative")
+	}
+
+	l.mu.Lock()
+	l.slots = nil
+	if n > 0 {
+		l.slots = make(chan struct{}, n)
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+// SetAdaptiveBatchSize lets the loader pick the batch size between min and max from the
+// response times: it grows while full batches are answered within target, and is halved
+// when they take longer.
+func (l *BatchLoader) SetAdaptiveBatchSize(min, max int, target time.Duration) error {
+	if min < 1 || max < min {
+		return fmt.Errorf("Batch size bounds must satisfy 1 <= min <= max")
+	}
+	if target <= 0 {
+		return fmt.Errorf("Target response time must be positive")
+	}
+
+	l.mu.Lock()
+	l.adaptive = true
+	l.minBatch = min
+	l.adaptiveMax = max
+	l.target = target
+	if l.maxBatch == 0 || l.maxBatch > max {
+		l.maxBatch = max
+	}
+	if l.maxBatch < min {
+		l.maxBatch = min
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+// BatchSize returns the current maximum batch size, 0 = no limit
+func (l *BatchLoader) BatchSize() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.maxBatch
+}
+
+// Flush sends the pending batch without waiting for the end of its window
+func (l *BatchLoader) Flush() {
+	l.mu.Lock()
+	b := l.batch
+	if b == nil || b.closing {
+		l.mu.Unlock()
+		return
+	}
+	b.closing = true
+	l.batch = nil
+	l.mu.Unlock()
+
+	go b.end(l)
+}
+
+// LoadNow loads a request and sends its batch right away, for latency sensitive callers
+func (l *BatchLoader) LoadNow(req *jsonrpc2.JSONRPCRequest) ([]byte, error) {
+	thunk := l.LoadThunk(req)
+	l.Flush()
+	return thunk()
+}
+
 // Load a request, batching will be applied automatically
 func (l *BatchLoader) Load(req *jsonrpc2.JSONRPCRequest) ([]byte, error) {
 	return l.LoadThunk(req)()
@@ -131,8 +255,8 @@ func (l *BatchLoader) LoadAllThunk(keys []*jsonrpc2.JSONRPCRequest) func() ([][]
 	}
 }
 
-// keyIndex will return the location of the key in the batch, if its not found
-// it will add the key to the batch
+// reqIndex will return the location of the request in the batch, if its not found
+// it will add the request to the batch
 func (b *batchLoaderBatch) reqIndex(l *BatchLoader, req *jsonrpc2.JSONRPCRequest) int {
 	for i, existingRequest := range b.requests {
 		if req == existingRequest {
@@ -140,8 +264,25 @@ func (b *batchLoaderBatch) reqIndex(l *BatchLoader, req *jsonrpc2.JSONRPCRequest
 		}
 	}
 
+	// the waiters of identical requests share the response of the first one
+	var key string
+	if l.deduplicate && provider.Shareable(req.Method) {
+		if k, err := req.Key(); err == nil {
+			key = k
+			if i, ok := b.keys[key]; ok {
+				return i
+			}
+		}
+	}
+
 	pos := len(b.requests)
 	b.requests = append(b.requests, req)
+	if key != "" {
+		if b.keys == nil {
+			b.keys = make(map[string]int)
+		}
+		b.keys[key] = pos
+	}
 	if pos == 0 {
 		go b.startTimer(l)
 	}
@@ -174,6 +315,123 @@ func (b *batchLoaderBatch) startTimer(l *BatchLoader) {
 }
 
 func (b *batchLoaderBatch) end(l *BatchLoader) {
-	b.data, b.error = l.fetch(b.requests)
+	l.mu.Lock()
+	observe := l.observe
+	slots := l.slots
+	l.mu.Unlock()
+
+	if slots != nil {
+		slots <- struct{}{}
+		defer func() { <-slots }()
+	}
+
+	b.data, b.error = l.send(b.requests, observe)
 	close(b.done)
 }
+
+// send fetches the requests. A batch the node finds too large is split in halves, and
+// the batch size lowered for the next ones.
+func (l *BatchLoader) send(requests []*jsonrpc2.JSONRPCRequest, observe func(size int)) ([][]byte, []error) {
+	if observe != nil {
+		observe(len(requests))
+	}
+
+	l.mu.Lock()
+	tooLarge, since := l.tooLarge, l.since
+	l.mu.Unlock()
+
+	start := time.Now()
+	data, errs := l.fetch(requests)
+	took := since(start)
+
+	if len(requests) < 2 || len(errs) != 1 || !tooLarge(errs[0]) {
+		l.adapt(len(requests), took)
+		return data, errs
+	}
+
+	half := len(requests) / 2
+	l.shrink(half)
+	firstData, firstErrs := l.send(requests[:half], observe)
+	secondData, secondErrs := l.send(requests[half:], observe)
+
+	data = append(spreadData(firstData, half), spreadData(secondData, len(requests)-half)...)
+	errs = append(spreadErrors(firstErrs, half), spreadErrors(secondErrs, len(requests)-half)...)
+	return data, errs
+}
+
+// adapt resizes the batches after one of size was answered in took
+func (l *BatchLoader) adapt(size int, took time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.adaptive {
+		return
+	}
+
+	switch {
+	case took > l.target:
+		l.maxBatch /= 2
+		if l.maxBatch < l.minBatch {
+			l.maxBatch = l.minBatch
+		}
+	case size >= l.maxBatch:
+		grow := l.maxBatch / 10
+		if grow < 1 {
+			grow = 1
+		}
+		l.maxBatch += grow
+		if l.maxBatch > l.adaptiveMax {
+			l.maxBatch = l.adaptiveMax
+		}
+	}
+}
+
+// shrink lowers the batch size to size after the node refused a larger batch
+func (l *BatchLoader) shrink(size int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxBatch == 0 || size < l.maxBatch {
+		l.maxBatch = size
+	}
+	// the node limit is not worth probing again
+	if l.adaptive && size < l.adaptiveMax {
+		l.adaptiveMax = size
+		if l.minBatch > size {
+			l.minBatch = size
+		}
+	}
+}
+
+// IsBatchTooLarge tells if err is a node refusing a batch because of its size: a http 413,
+// or the invalid request error of geth saying "batch too large"
+func IsBatchTooLarge(err error) bool {
+	switch e := err.(type) {
+	case *etherr.HTTPError:
+		return e.StatusCode == http.StatusRequestEntityTooLarge
+	case *etherr.RpcError:
+		return e.Code == -32600 && strings.Contains(strings.ToLower(e.Error()), "batch too large")
+	}
+	return false
+}
+
+// spreadData gives the responses of n requests, failed fetches return none
+func spreadData(data [][]byte, n int) [][]byte {
+	if len(data) == n {
+		return data
+	}
+	return make([][]byte, n)
+}
+
+// spreadErrors gives the errors of n requests, a single error applies to all of them
+func spreadErrors(errs []error, n int) []error {
+	if len(errs) == n {
+		return errs
+	}
+	spread := make([]error, n)
+	if len(errs) == 1 {
+		for i := range spread {
+			spread[i] = errs[0]
+		}
+	}
+	return spread
+}
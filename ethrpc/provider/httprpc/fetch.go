@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
 	"github.com/alethio/web3-go/jsonrpc2"
-	"github.com/sirupsen/logrus"
 )
 
 func (p *HTTPProvider) fetchSingle(request *jsonrpc2.JSONRPCRequest) ([]byte, error) {
@@ -15,6 +18,9 @@ func (p *HTTPProvider) fetchSingle(request *jsonrpc2.JSONRPCRequest) ([]byte, er
 		return nil, err
 	}
 
+	if p.throttle != nil {
+		defer p.throttle.Acquire([]*jsonrpc2.JSONRPCRequest{request})()
+	}
 	return p.fetch(payload)
 }
 
@@ -24,18 +30,28 @@ func (p *HTTPProvider) fetchMultiple(requests []*jsonrpc2.JSONRPCRequest) ([][]b
 		return nil, []error{err}
 	}
 
-	logrus.Debugf("Making http request with %d RPCs\n", len(requests))
+	if p.throttle != nil {
+		defer p.throttle.Acquire(requests)()
+	}
 	response, err := p.fetch(payload)
 	if err != nil {
 		return [][]byte{}, []error{err}
 	}
 
-	responses, err := jsonrpc2.DecodeResponses(response)
-	castedResponses := make([][]byte, len(responses))
-	for index, resp := range responses {
-		castedResponses[index] = []byte(resp)
+	// a single error for the whole batch, see LoadThunk
+	messages, err := provider.DecodeBatchResponse(response)
+	if err != nil {
+		return [][]byte{}, []error{err}
 	}
-	return castedResponses, []error{err}
+
+	matched, errs := provider.MatchResponses(requests, messages)
+	responses := make([][]byte, len(requests))
+	for i, msg := range matched {
+		if msg != nil {
+			responses[i] = msg.Raw
+		}
+	}
+	return responses, errs
 }
 
 func (p *HTTPProvider) fetch(payload []byte) ([]byte, error) {
@@ -46,6 +62,14 @@ func (p *HTTPProvider) fetch(payload []byte) ([]byte, error) {
 	defer httpRequest.Body.Close()
 
 	httpRequest.Header.Add("Content-Type", "application/json")
+	provider.MergeHeaders(httpRequest.Header, p.header)
+	if p.headerFunc != nil {
+		header, err := p.headerFunc()
+		if err != nil {
+			return nil, err
+		}
+		provider.MergeHeaders(httpRequest.Header, header)
+	}
 
 	response, err := p.client.Do(httpRequest)
 	if err != nil {
@@ -58,5 +82,35 @@ func (p *HTTPProvider) fetch(payload []byte) ([]byte, error) {
 		return nil, err
 	}
 
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		// nodes and hosted providers explain some of them in a json rpc error, like a rate
+		// limit answered with -32005 and a 429
+		if msg, err := jsonrpc2.DecodeResponse(responseBody); err == nil && msg.Error != nil {
+			return nil, etherr.New(msg.Error.Message, msg.Error.Code, msg.Error.Data)
+		}
+		return nil, &etherr.HTTPError{
+			StatusCode: response.StatusCode,
+			Status:     response.Status,
+			RetryAfter: retryAfter(response.Header.Get("Retry-After")),
+			Body:       responseBody,
+		}
+	}
+
 	return responseBody, nil
 }
+
+// retryAfter parses the Retry-After header which holds either seconds or a date
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
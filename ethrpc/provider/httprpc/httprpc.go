@@ -3,24 +3,41 @@ package httprpc
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 
-	"github.com/alethio/web3-go/etherr"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/alethio/web3-go/ethrpc/provider"
 	"github.com/alethio/web3-go/jsonrpc2"
 )
 
 const (
 	// DefaultHTTPTimeout is the default timeout interval for http requests
 	DefaultHTTPTimeout = 3 * time.Second
+
+	// DefaultDialTimeout is the default time a tcp connection has to be established, as in
+	// http.DefaultTransport
+	DefaultDialTimeout = 30 * time.Second
+
+	// DefaultKeepAlive is the default period of the tcp keep-alive probes, as in
+	// http.DefaultTransport
+	DefaultKeepAlive = 30 * time.Second
 )
 
 // HTTPProvider implements ethereum RPC calls over HTTP
 type HTTPProvider struct {
 	client      *http.Client
+	transport   *http.Transport
+	dialer      *net.Dialer
 	url         string
 	loader      RPCLoader
 	httpTimeout time.Duration
+	throttle    Throttle
+	flights     *singleflight.Group
+	header      http.Header
+	headerFunc  func() (http.Header, error)
 }
 
 type RPCLoader interface {
@@ -28,6 +45,12 @@ type RPCLoader interface {
 	Init(p *HTTPProvider)
 }
 
+// Throttle is asked for permission before every http request with the RPCs it carries.
+// The returned function is called once the response was received.
+type Throttle interface {
+	Acquire(reqs []*jsonrpc2.JSONRPCRequest) (release func())
+}
+
 // Start does nothing on the http provider
 func (p *HTTPProvider) Start() error {
 	// TODO: maybe check if server is reachable?
@@ -42,13 +65,13 @@ func (p *HTTPProvider) Stop() {
 // CallRaw calls a RPC method and returns the raw result
 func (p *HTTPProvider) CallRaw(method string, params ...interface{}) ([]byte, error) {
 	req := jsonrpc2.BuildRequest(method, params)
-	return p.loader.Load(req)
+	return p.load(req)
 }
 
 // Call calls a RPC method and returns coresponding object
 func (p *HTTPProvider) Call(result interface{}, method string, params ...interface{}) error {
 	req := jsonrpc2.BuildRequest(method, params)
-	raw, err := p.loader.Load(req)
+	raw, err := p.load(req)
 	if err != nil {
 		return err
 	}
@@ -58,29 +81,54 @@ func (p *HTTPProvider) Call(result interface{}, method string, params ...interfa
 		return err
 	}
 
-	null := string(json.RawMessage([]byte("null")))
-	if string(resp.Result) == null {
-		return etherr.Nil
+	return provider.DecodeResult(resp, result)
+}
+
+// load sends a request through the loader. In singleflight mode identical requests
+// in flight wait for the response of the first one instead.
+func (p *HTTPProvider) load(req *jsonrpc2.JSONRPCRequest) ([]byte, error) {
+	if p.flights == nil || !provider.Shareable(req.Method) {
+		return p.loader.Load(req)
+	}
+	key, err := req.Key()
+	if err != nil {
+		return p.loader.Load(req)
 	}
 
-	if resp.Error != nil {
-		switch resp.Error.Code {
-		case -32015: // VM execution error
-			err := etherr.VMExecutionError.(*etherr.RpcError)
-			err.Code = resp.Error.Code
-			err.Details = resp.Error.Data
-			return err
-		default:
-			return etherr.New(resp.Error.Message, resp.Error.Code, resp.Error.Data)
-		}
+	v, err, _ := p.flights.Do(key, func() (interface{}, error) {
+		return p.loader.Load(req)
+	})
+	raw, _ := v.([]byte)
+	return raw, err
+}
+
+// CallBatch sends the calls in a single http request, bypassing the loader
+func (p *HTTPProvider) CallBatch(batch []*provider.BatchElem) error {
+	if len(batch) == 0 {
+		return nil
 	}
 
-	err = json.Unmarshal(resp.Result, &result)
+	requests := provider.BatchRequests(batch)
+	payload, err := jsonrpc2.EncodeClientRequests(requests)
+	if err != nil {
+		return err
+	}
+
+	if p.throttle != nil {
+		defer p.throttle.Acquire(requests)()
+	}
+	raw, err := p.fetch(payload)
+	if err != nil {
+		return err
+	}
+
+	messages, err := provider.DecodeBatchResponse(raw)
 	if err != nil {
 		return err
 	}
-	return nil
 
+	provider.DecodeBatch(batch, requests, messages)
+	return nil
 }
 
 // Subscribe creates a subscription to event using method. not available on http
@@ -88,33 +136,77 @@ func (p *HTTPProvider) Subscribe(receiver chan *json.RawMessage, method string,
 	return fmt.Errorf("subscriptions not supported over http, please use websockets")
 }
 
-// New initializes a Client and returns it
-func New(url string) (*HTTPProvider, error) {
-	loader, err := NewSyncLoader()
+// New initializes a Client configured by the options and returns it.
+// The user and password of the url are sent as basic auth.
+func New(url string, opts ...Option) (*HTTPProvider, error) {
+	url, header, err := provider.StripUserinfo(url)
 	if err != nil {
 		return nil, err
 	}
-	return NewWithLoader(url, loader)
-}
 
-// NewWithLoader initializes a Client with a specified loader and returns it
-func NewWithLoader(url string, loader RPCLoader) (*HTTPProvider, error) {
-	var httpClient = &http.Client{
-		Transport: &http.Transport{},
-		Timeout:   DefaultHTTPTimeout,
+	dialer := &net.Dialer{
+		Timeout:   DefaultDialTimeout,
+		KeepAlive: DefaultKeepAlive,
 	}
-
+	transport := &http.Transport{DialContext: dialer.DialContext}
 	p := &HTTPProvider{
-		url:    url,
-		client: httpClient,
-		loader: loader,
+		url: url,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   DefaultHTTPTimeout,
+		},
+		transport: transport,
+		dialer:    dialer,
+		header:    header,
 	}
-	loader.Init(p)
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.loader == nil {
+		loader, err := NewSyncLoader()
+		if err != nil {
+			return nil, err
+		}
+		p.loader = loader
+	}
+	p.loader.Init(p)
 	return p, nil
+}
 
+// NewWithLoader initializes a Client with a specified loader and returns it
+func NewWithLoader(url string, loader RPCLoader) (*HTTPProvider, error) {
+	return New(url, WithLoader(loader))
 }
 
 // SetHTTPTimeout allows setting the http timeout from outside
 func (p *HTTPProvider) SetHTTPTimeout(httpTimeout time.Duration) {
 	p.client.Timeout = httpTimeout
 }
+
+// SetSingleflight enables or disables sharing the response of a call with the identical
+// calls made while it is in flight
+func (p *HTTPProvider) SetSingleflight(enabled bool) {
+	p.flights = nil
+	if enabled {
+		p.flights = &singleflight.Group{}
+	}
+}
+
+// SetHeader sets a header sent with every request, like an api key or a bearer token
+func (p *HTTPProvider) SetHeader(key, value string) {
+	p.header.Set(key, value)
+}
+
+// SetHeaderFunc sets a function called before every request for headers changing over
+// time, like rotating tokens. Its headers take precedence over the static ones.
+func (p *HTTPProvider) SetHeaderFunc(f func() (http.Header, error)) {
+	p.headerFunc = f
+}
+
+// SetThrottle sets the throttle asked before every http request, nil disables it
+func (p *HTTPProvider) SetThrottle(t Throttle) {
+	p.throttle = t
+}
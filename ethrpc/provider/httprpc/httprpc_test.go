@@ -0,0 +1,459 @@
+package httprpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/jsonrpc2"
+	"github.com/alethio/web3-go/rpctest"
+)
+
+func TestHTTPProvider_Call(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+	srv.HandleParams("eth_getBlockByNumber", []interface{}{"0x1", false}, nil)
+	srv.HandleError("eth_call", -32015, "VM execution error.")
+
+	p, err := New(srv.URL)
+	assert.NoError(t, err)
+
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, "0x10", result)
+
+	assert.Equal(t, etherr.Nil, p.Call(&result, "eth_getBlockByNumber", "0x1", false))
+	assert.Equal(t, etherr.VMExecutionError, p.Call(&result, "eth_call", map[string]string{}, "latest"))
+
+	err = p.Call(&result, "eth_unknown")
+	assert.IsType(t, &etherr.RpcError{}, err)
+	assert.Equal(t, rpctest.MethodNotFound, err.(*etherr.RpcError).Code)
+
+	srv.FailNext(503, 0)
+	err = p.Call(&result, "eth_blockNumber")
+	assert.IsType(t, &etherr.HTTPError{}, err)
+	assert.Equal(t, 503, err.(*etherr.HTTPError).StatusCode)
+	assert.Error(t, p.Call(&result, "eth_blockNumber"))
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+}
+
+func TestHTTPProvider_StatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "limited") {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"jsonrpc":"2.0","id":"1","error":{"code":-32005,"message":"daily request count exceeded"}}`)
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, "Too Many Requests")
+	}))
+	defer srv.Close()
+
+	// the json rpc error explains the status
+	p, err := New(srv.URL + "/limited")
+	assert.NoError(t, err)
+	var result string
+	err = p.Call(&result, "eth_blockNumber")
+	if assert.IsType(t, &etherr.RpcError{}, err) {
+		assert.Equal(t, -32005, err.(*etherr.RpcError).Code)
+	}
+
+	p, err = New(srv.URL)
+	assert.NoError(t, err)
+	err = p.Call(&result, "eth_blockNumber")
+	if assert.IsType(t, &etherr.HTTPError{}, err) {
+		assert.Equal(t, http.StatusTooManyRequests, err.(*etherr.HTTPError).StatusCode)
+	}
+}
+
+func TestBatchLoader(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+	srv.HandleParams("eth_getBalance", []interface{}{"0x1", "latest"}, "0x1")
+	srv.HandleParams("eth_getBalance", []interface{}{"0x2", "latest"}, "0x2")
+
+	loader, err := NewBatchLoader(10, 20*time.Millisecond)
+	assert.NoError(t, err)
+	p, err := NewWithLoader(srv.URL, loader)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for _, address := range []string{"0x1", "0x2", "0x1", "0x2"} {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			var balance string
+			assert.NoError(t, p.Call(&balance, "eth_getBalance", address, "latest"))
+			assert.Equal(t, address, balance)
+		}(address)
+	}
+	wg.Wait()
+
+	// a single http request for the whole batch, identical requests are sent once
+	assert.Len(t, srv.Requests(), 2)
+	srv.FailNext(502)
+	var result string
+	assert.IsType(t, &etherr.HTTPError{}, p.Call(&result, "eth_blockNumber"))
+}
+
+func TestBatchLoader_MatchByID(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.HandleParams("eth_getBalance", []interface{}{"0x1", "latest"}, "0x1")
+	srv.HandleParams("eth_getBalance", []interface{}{"0x2", "latest"}, "0x2")
+	srv.HandleParams("eth_getBalance", []interface{}{"0x3", "latest"}, "0x3")
+	srv.ReverseBatches(true)
+
+	loader, err := NewBatchLoader(10, 20*time.Millisecond)
+	assert.NoError(t, err)
+	p, err := NewWithLoader(srv.URL, loader)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for _, address := range []string{"0x1", "0x2", "0x3"} {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			var balance string
+			assert.NoError(t, p.Call(&balance, "eth_getBalance", address, "latest"))
+			assert.Equal(t, address, balance)
+		}(address)
+	}
+	wg.Wait()
+
+	// a node refusing the batch fails every call with its error
+	srv.RejectBatches(-32600, "batch too large")
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			var result string
+			errs <- p.Call(&result, "eth_getBalance", "0x1", "latest")
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		err := <-errs
+		assert.IsType(t, &etherr.RpcError{}, err)
+		assert.Equal(t, -32600, err.(*etherr.RpcError).Code)
+	}
+}
+
+func TestHTTPProvider_fetchMultiple(t *testing.T) {
+	// answers the first request twice and leaves out the last one
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqs []*jsonrpc2.JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&reqs)
+
+		var out []*jsonrpc2.JSONRPCMessage
+		for _, req := range reqs[:len(reqs)-1] {
+			out = append(out, &jsonrpc2.JSONRPCMessage{Version: "2.0", ID: req.ID, Result: json.RawMessage(`"` + req.Method + `"`)})
+		}
+		out = append(out, out[0])
+		json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+
+	p, err := New(srv.URL)
+	assert.NoError(t, err)
+
+	requests := []*jsonrpc2.JSONRPCRequest{
+		jsonrpc2.BuildRequest("eth_first", nil),
+		jsonrpc2.BuildRequest("eth_second", nil),
+		jsonrpc2.BuildRequest("eth_third", nil),
+	}
+	responses, errs := p.fetchMultiple(requests)
+	assert.Len(t, errs, 3)
+	assert.Equal(t, etherr.DuplicateResponse, errs[0])
+	assert.NoError(t, errs[1])
+	assert.Contains(t, string(responses[1]), `"eth_second"`)
+	assert.Equal(t, etherr.MissingResponse, errs[2])
+}
+
+func TestBatchLoader_Deduplication(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_call", "0x1")
+	srv.Handle("eth_newBlockFilter", "0x2")
+	srv.Handle("personal_sendTransaction", "0xdead")
+	srv.Handle("eth_sendRawTransaction", "0xbeef")
+
+	loader, err := NewBatchLoader(10, 20*time.Millisecond)
+	assert.NoError(t, err)
+	p, err := NewWithLoader(srv.URL, loader)
+	assert.NoError(t, err)
+
+	type call struct {
+		To   string `json:"to"`
+		Data string `json:"data"`
+	}
+	params := []interface{}{
+		call{To: "0xa", Data: "0x06fdde03"},
+		map[string]string{"data": "0x06fdde03", "to": "0xa"},
+		call{To: "0xa", Data: "0x06fdde03"},
+	}
+
+	var wg sync.WaitGroup
+	for _, param := range params {
+		wg.Add(4)
+		go func(param interface{}) {
+			defer wg.Done()
+			var result string
+			assert.NoError(t, p.Call(&result, "eth_call", param, "latest"))
+			assert.Equal(t, "0x1", result)
+		}(param)
+		go func() {
+			defer wg.Done()
+			var result string
+			assert.NoError(t, p.Call(&result, "eth_newBlockFilter"))
+		}()
+		go func() {
+			defer wg.Done()
+			var result string
+			assert.NoError(t, p.Call(&result, "personal_sendTransaction", call{To: "0xa"}, "secret"))
+		}()
+		go func() {
+			defer wg.Done()
+			var result string
+			assert.NoError(t, p.Call(&result, "eth_sendRawTransaction", "0x00"))
+		}()
+	}
+	wg.Wait()
+
+	// equal params give the same request whatever their type, filters and transactions
+	// are never shared
+	assert.Equal(t, 1, srv.Count("eth_call"))
+	assert.Equal(t, 3, srv.Count("eth_newBlockFilter"))
+	assert.Equal(t, 3, srv.Count("personal_sendTransaction"))
+	assert.Equal(t, 3, srv.Count("eth_sendRawTransaction"))
+}
+
+func TestHTTPProvider_Singleflight(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_getTransactionReceipt", map[string]string{"status": "0x1"})
+	srv.SetLatency(50 * time.Millisecond)
+
+	p, err := New(srv.URL)
+	assert.NoError(t, err)
+	p.SetSingleflight(true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var receipt map[string]string
+			assert.NoError(t, p.Call(&receipt, "eth_getTransactionReceipt", "0xdead"))
+			assert.Equal(t, "0x1", receipt["status"])
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, srv.Count("eth_getTransactionReceipt"))
+
+	p.SetSingleflight(false)
+	var receipt map[string]string
+	assert.NoError(t, p.Call(&receipt, "eth_getTransactionReceipt", "0xdead"))
+	assert.Equal(t, 2, srv.Count("eth_getTransactionReceipt"))
+}
+
+func TestBatchLoader_MaxConcurrentBatches(t *testing.T) {
+	var inFlight, maxInFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		var reqs []*jsonrpc2.JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&reqs)
+		var out []*jsonrpc2.JSONRPCMessage
+		for _, req := range reqs {
+			out = append(out, &jsonrpc2.JSONRPCMessage{Version: "2.0", ID: req.ID, Result: json.RawMessage(`"0x1"`)})
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+
+	loader, err := NewBatchLoader(1, time.Millisecond)
+	assert.NoError(t, err)
+	assert.NoError(t, loader.SetMaxConcurrentBatches(2))
+	p, err := NewWithLoader(srv.URL, loader)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var result string
+			assert.NoError(t, p.Call(&result, "eth_getBalance", fmt.Sprintf("0x%x", i), "latest"))
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxInFlight))
+}
+
+func TestBatchLoader_BatchTooLarge(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_getBalance", "0x1")
+	srv.SetBatchLimit(3)
+
+	loader, err := NewBatchLoader(0, 20*time.Millisecond)
+	assert.NoError(t, err)
+	_, err = NewWithLoader(srv.URL, loader)
+	assert.NoError(t, err)
+
+	reqs := make([]*jsonrpc2.JSONRPCRequest, 8)
+	for i := range reqs {
+		reqs[i] = jsonrpc2.BuildRequest("eth_getBalance", []interface{}{fmt.Sprintf("0x%x", i), "latest"})
+	}
+	_, errs := loader.LoadAll(reqs)
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	// 8 was split in 4 and 4, then in 2 and 2
+	assert.Equal(t, 2, loader.BatchSize())
+	// refused batches are not answered, every call was answered once
+	assert.Equal(t, 8, srv.Count("eth_getBalance"))
+}
+
+func TestIsBatchTooLarge(t *testing.T) {
+	assert.True(t, IsBatchTooLarge(&etherr.HTTPError{StatusCode: 413}))
+	assert.True(t, IsBatchTooLarge(etherr.New("batch too large", -32600, "")))
+	// rate limits are not about the size of the batch
+	assert.False(t, IsBatchTooLarge(etherr.New("daily batch limit exceeded", -32005, "")))
+	assert.False(t, IsBatchTooLarge(&etherr.HTTPError{StatusCode: 429}))
+}
+
+func TestBatchLoader_Adaptive(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_getBalance", "0x1")
+
+	// batches are sent when full or flushed, the response times are made up
+	loader, err := NewBatchLoader(8, time.Minute)
+	assert.NoError(t, err)
+	assert.Error(t, loader.SetAdaptiveBatchSize(4, 2, time.Second))
+	assert.NoError(t, loader.SetAdaptiveBatchSize(2, 8, 20*time.Millisecond))
+	var took int64
+	loader.since = func(time.Time) time.Duration {
+		return time.Duration(atomic.LoadInt64(&took))
+	}
+	_, err = NewWithLoader(srv.URL, loader)
+	assert.NoError(t, err)
+
+	load := func(n int) {
+		reqs := make([]*jsonrpc2.JSONRPCRequest, n)
+		for i := range reqs {
+			reqs[i] = jsonrpc2.BuildRequest("eth_getBalance", []interface{}{fmt.Sprintf("0x%x", i), "latest"})
+		}
+		thunk := loader.LoadAllThunk(reqs)
+		loader.Flush()
+		_, errs := thunk()
+		for _, err := range errs {
+			assert.NoError(t, err)
+		}
+	}
+
+	// slow answers halve the size
+	atomic.StoreInt64(&took, int64(50*time.Millisecond))
+	load(1)
+	assert.Equal(t, 4, loader.BatchSize())
+
+	// full batches answered in time grow it
+	atomic.StoreInt64(&took, int64(time.Millisecond))
+	load(4)
+	assert.Equal(t, 5, loader.BatchSize())
+}
+
+func TestBatchLoader_Flush(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	loader, err := NewBatchLoader(10, time.Minute)
+	assert.NoError(t, err)
+	_, err = NewWithLoader(srv.URL, loader)
+	assert.NoError(t, err)
+
+	raw, err := loader.LoadNow(jsonrpc2.BuildRequest("eth_blockNumber", nil))
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), `"0x10"`)
+
+	thunk := loader.LoadThunk(jsonrpc2.BuildRequest("eth_blockNumber", []interface{}{}))
+	loader.Flush()
+	_, err = thunk()
+	assert.NoError(t, err)
+}
+
+func TestHTTPProvider_Headers(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	u := strings.Replace(srv.URL, "http://", "http://user:secret@", 1)
+	p, err := New(u)
+	assert.NoError(t, err)
+	p.SetHeader("X-Api-Key", "key")
+	token := 0
+	p.SetHeaderFunc(func() (http.Header, error) {
+		token++
+		h := make(http.Header)
+		h.Set("Authorization", fmt.Sprintf("Bearer %d", token))
+		return h, nil
+	})
+
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+
+	headers := srv.Headers()
+	assert.Len(t, headers, 2)
+	assert.Equal(t, "key", headers[0].Get("X-Api-Key"))
+	assert.Equal(t, "application/json", headers[0].Get("Content-Type"))
+	// the header function takes precedence over the basic auth of the url
+	assert.Equal(t, "Bearer 1", headers[0].Get("Authorization"))
+	assert.Equal(t, "Bearer 2", headers[1].Get("Authorization"))
+
+	p.SetHeaderFunc(nil)
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	user, password, ok := (&http.Request{Header: srv.Headers()[2]}).BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "secret", password)
+
+	p.SetHeaderFunc(func() (http.Header, error) { return nil, fmt.Errorf("token expired") })
+	assert.EqualError(t, p.Call(&result, "eth_blockNumber"), "token expired")
+}
+
+func TestWithKeepAlive(t *testing.T) {
+	// the dial timeout is kept
+	p, err := New("http://localhost:8545", WithKeepAlive(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, p.dialer.KeepAlive)
+	assert.Equal(t, DefaultDialTimeout, p.dialer.Timeout)
+
+	p, err = New("http://localhost:8545", WithDialTimeout(time.Second), WithKeepAlive(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, p.dialer.Timeout)
+
+	_, err = New("http://localhost:8545", WithDialTimeout(0))
+	assert.Error(t, err)
+}
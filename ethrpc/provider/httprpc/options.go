@@ -0,0 +1,123 @@
+package httprpc
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Option configures a HTTPProvider when it is created
+type Option func(p *HTTPProvider) error
+
+// WithTimeout sets the timeout of the http requests, DefaultHTTPTimeout otherwise
+func WithTimeout(d time.Duration) Option {
+	return func(p *HTTPProvider) error {
+		p.client.Timeout = d
+		return nil
+	}
+}
+
+// WithMaxIdleConns sets the number of idle connections kept open for reuse
+func WithMaxIdleConns(n int) Option {
+	return func(p *HTTPProvider) error {
+		if n < 0 {
+			return fmt.Errorf("Maximum idle connections can not be negative")
+		}
+		p.transport.MaxIdleConns = n
+		p.transport.MaxIdleConnsPerHost = n
+		return nil
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection is kept open
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(p *HTTPProvider) error {
+		p.transport.IdleConnTimeout = d
+		return nil
+	}
+}
+
+// WithKeepAlive sets the period of the tcp keep-alive probes, a negative period
+// disables keep-alive and closes the connections after every request
+func WithKeepAlive(period time.Duration) Option {
+	return func(p *HTTPProvider) error {
+		if period < 0 {
+			p.transport.DisableKeepAlives = true
+			return nil
+		}
+		p.dialer.KeepAlive = period
+		return nil
+	}
+}
+
+// WithDialTimeout sets the time a tcp connection has to be established, DefaultDialTimeout
+// otherwise
+func WithDialTimeout(d time.Duration) Option {
+	return func(p *HTTPProvider) error {
+		if d <= 0 {
+			return fmt.Errorf("Dial timeout must be positive")
+		}
+		p.dialer.Timeout = d
+		return nil
+	}
+}
+
+// WithTLSConfig sets the tls configuration of https connections
+func WithTLSConfig(config *tls.Config) Option {
+	return func(p *HTTPProvider) error {
+		p.transport.TLSClientConfig = config
+		return nil
+	}
+}
+
+// WithProxy sets the function picking the proxy of a request, like http.ProxyFromEnvironment
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(p *HTTPProvider) error {
+		p.transport.Proxy = proxy
+		return nil
+	}
+}
+
+// WithLoader sets the loader of the requests, a SyncLoader otherwise
+func WithLoader(loader RPCLoader) Option {
+	return func(p *HTTPProvider) error {
+		p.loader = loader
+		return nil
+	}
+}
+
+// WithHeader sets a header sent with every request, see SetHeader
+func WithHeader(key, value string) Option {
+	return func(p *HTTPProvider) error {
+		p.SetHeader(key, value)
+		return nil
+	}
+}
+
+// WithHeaderFunc sets a function called for the headers of every request, see SetHeaderFunc
+func WithHeaderFunc(f func() (http.Header, error)) Option {
+	return func(p *HTTPProvider) error {
+		p.headerFunc = f
+		return nil
+	}
+}
+
+// WithThrottle sets the throttle asked before every request, see SetThrottle
+func WithThrottle(t Throttle) Option {
+	return func(p *HTTPProvider) error {
+		p.throttle = t
+		return nil
+	}
+}
+
+// WithSingleflight shares the response of a call with the identical calls made while it is in flight
+func WithSingleflight() Option {
+	return func(p *HTTPProvider) error {
+		p.flights = &singleflight.Group{}
+		return nil
+	}
+}
@@ -0,0 +1,274 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/alethio/web3-go/logger"
+)
+
+// maxLoggedResponse is the number of bytes of a response the debug logger shows
+const maxLoggedResponse = 256
+
+// Request is a call going through the interceptors
+type Request struct {
+	Method string
+	Params []interface{}
+
+	// Receiver is set for subscriptions only, Event is the subscribed event
+	Receiver chan *json.RawMessage
+	Event    string
+	// Errs receives the errors of the subscription, if set, see ErrSubscriber
+	Errs chan error
+
+	// batch is set for the calls of a batch, copies of the request share it
+	batch *batchSlot
+}
+
+// IsSubscription returns true if the request creates a subscription
+func (r *Request) IsSubscription() bool {
+	return r.Receiver != nil
+}
+
+// Handler answers a request with the raw json rpc response, subscriptions have no response
+type Handler func(req *Request) ([]byte, error)
+
+// Interceptor wraps a handler, it can look at or change the request and the response
+type Interceptor func(next Handler) Handler
+
+type chain struct {
+	Interface
+	handler Handler
+}
+
+// Chain returns a provider sending Call, CallRaw and Subscribe through the interceptors,
+// the first interceptor being the outermost one
+func Chain(p Interface, interceptors ...Interceptor) Interface {
+	handler := func(req *Request) ([]byte, error) {
+		if req.IsSubscription() {
+			return nil, SubscribeErr(p, req.Receiver, req.Errs, req.Method, req.Event, req.Params...)
+		}
+		if req.batch != nil {
+			return req.batch.join(req)
+		}
+		return p.CallRaw(req.Method, req.Params...)
+	}
+
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		handler = interceptors[i](handler)
+	}
+
+	return &chain{
+		Interface: p,
+		handler:   handler,
+	}
+}
+
+// CallRaw calls a RPC method through the interceptors
+func (c *chain) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	return c.handler(&Request{Method: method, Params: params})
+}
+
+// Call calls a RPC method through the interceptors and decodes the result
+func (c *chain) Call(result interface{}, method string, params ...interface{}) error {
+	raw, err := c.handler(&Request{Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	return Decode(raw, result)
+}
+
+// Subscribe creates a subscription through the interceptors
+func (c *chain) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	return c.SubscribeErr(receiver, nil, method, event, params...)
+}
+
+// SubscribeErr creates a subscription reporting its errors through the interceptors
+func (c *chain) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	_, err := c.handler(&Request{
+		Method:   method,
+		Params:   params,
+		Receiver: receiver,
+		Event:    event,
+		Errs:     errs,
+	})
+	return err
+}
+
+// CallBatch sends every call of the batch through the interceptors, the calls reaching the
+// provider are sent together in a single batch when it is a Batcher, see collector. The
+// error is the one of that batch as a whole.
+func (c *chain) CallBatch(batch []*BatchElem) error {
+	if _, ok := c.Interface.(Batcher); !ok {
+		callEach(c, batch)
+		return nil
+	}
+
+	col := &collector{
+		provider: c.Interface,
+		waiting:  len(batch),
+	}
+	var wg sync.WaitGroup
+	for _, elem := range batch {
+		wg.Add(1)
+		go func(elem *BatchElem) {
+			defer wg.Done()
+
+			slot := &batchSlot{collector: col}
+			elem.Raw, elem.Error = c.handler(&Request{Method: elem.Method, Params: elem.Params, batch: slot})
+			// answered on the way, like a cache hit, the batch does not wait for it
+			col.leave(slot)
+			if elem.Error == nil {
+				elem.Error = Decode(elem.Raw, elem.Result)
+			}
+		}(elem)
+	}
+	wg.Wait()
+	return col.err
+}
+
+// collector gathers the calls of a batch which went through the interceptors, the batch
+// is sent once every call either reached the provider or was answered on the way. Calls
+// which waited batchWait without another one joining are sent without the rest, so
+// interceptors making the calls wait for each other, like a mutex, only split the batch.
+type collector struct {
+	provider Interface
+
+	mu      sync.Mutex
+	waiting int
+	sent    bool
+	group   *group
+	err     error
+}
+
+// batchWait is how long the calls which reached the provider wait for the others
+const batchWait = 20 * time.Millisecond
+
+// group is the part of the batch sent together
+type group struct {
+	elems []*BatchElem
+	timer *time.Timer
+	done  chan struct{}
+	err   error
+}
+
+// batchSlot is the place of a call in the batch, it is taken at most once
+type batchSlot struct {
+	collector *collector
+	joined    bool
+	left      bool
+}
+
+// join adds the call to the batch and waits for its response. Interceptors calling the
+// handler again, like retries, come after the batch was sent: the call is made on its own.
+func (s *batchSlot) join(req *Request) ([]byte, error) {
+	c := s.collector
+	c.mu.Lock()
+	if s.joined || s.left || c.sent {
+		c.mu.Unlock()
+		return c.provider.CallRaw(req.Method, req.Params...)
+	}
+	s.joined = true
+	elem := &BatchElem{Method: req.Method, Params: req.Params, Result: new(json.RawMessage)}
+	g := c.group
+	if g == nil {
+		g = &group{done: make(chan struct{})}
+		g.timer = time.AfterFunc(batchWait, func() { c.send(g) })
+		c.group = g
+	} else {
+		g.timer.Reset(batchWait)
+	}
+	g.elems = append(g.elems, elem)
+	c.mu.Unlock()
+
+	c.leave(nil)
+	<-g.done
+	if g.err != nil {
+		return nil, g.err
+	}
+	if elem.Raw == nil {
+		return nil, elem.Error
+	}
+	return elem.Raw, nil
+}
+
+// leave tells the collector a call is done going through the interceptors, the last one
+// sends the batch. A nil slot is a call which joined the batch.
+func (c *collector) leave(s *batchSlot) {
+	c.mu.Lock()
+	if s != nil {
+		if s.joined || s.left {
+			c.mu.Unlock()
+			return
+		}
+		s.left = true
+	}
+	c.waiting--
+	last := c.waiting == 0
+	if last {
+		c.sent = true
+	}
+	g := c.group
+	c.mu.Unlock()
+
+	if last && g != nil {
+		c.send(g)
+	}
+}
+
+// send sends the calls of g in a single batch, unless they were already sent. The error
+// of the batch is the first one of its groups.
+func (c *collector) send(g *group) {
+	c.mu.Lock()
+	if c.group != g {
+		c.mu.Unlock()
+		return
+	}
+	c.group = nil
+	c.mu.Unlock()
+	g.timer.Stop()
+
+	g.err = c.provider.(Batcher).CallBatch(g.elems)
+
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = g.err
+	}
+	c.mu.Unlock()
+	close(g.done)
+}
+
+// DebugLogger logs every request and its response at debug level, nil logs to logger.Default
+func DebugLogger(l logger.Logger) Interceptor {
+	if l == nil {
+		l = logger.Default()
+	}
+
+	return func(next Handler) Handler {
+		return func(req *Request) ([]byte, error) {
+			start := time.Now()
+			raw, err := next(req)
+
+			fields := fmt.Sprintf("method=%s params=%v duration=%s", req.Method, req.Params, time.Since(start))
+			if req.IsSubscription() {
+				fields += " event=" + req.Event
+			}
+
+			switch {
+			case err != nil:
+				l.Debugf("rpc request failed: %s error=%s", fields, err)
+			case req.IsSubscription():
+				l.Debugf("rpc subscription: %s", fields)
+			default:
+				response := raw
+				if len(response) > maxLoggedResponse {
+					response = append(response[:maxLoggedResponse:maxLoggedResponse], "..."...)
+				}
+				l.Debugf("rpc request: %s response=%s", fields, response)
+			}
+			return raw, err
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/etherr"
+)
+
+// echo answers every call with its method name
+type echo struct {
+	subscribed string
+}
+
+func (e *echo) Start() error { return nil }
+func (e *echo) Stop()        {}
+func (e *echo) Call(result interface{}, method string, params ...interface{}) error {
+	return fmt.Errorf("not used by the chain")
+}
+func (e *echo) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	if method == "eth_missing" {
+		return []byte(`{"jsonrpc":"2.0","id":"1","result":null}`), nil
+	}
+	return []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":"1","result":%q}`, method)), nil
+}
+func (e *echo) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	e.subscribed = event
+	return nil
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	trace := func(name string) Interceptor {
+		return func(next Handler) Handler {
+			return func(req *Request) ([]byte, error) {
+				calls = append(calls, name+" "+req.Method)
+				return next(req)
+			}
+		}
+	}
+	rename := func(next Handler) Handler {
+		return func(req *Request) ([]byte, error) {
+			if req.Method == "eth_old" {
+				req.Method = "eth_new"
+			}
+			return next(req)
+		}
+	}
+
+	e := &echo{}
+	p := Chain(e, trace("outer"), rename, trace("inner"))
+
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_old"))
+	assert.Equal(t, "eth_new", result)
+	assert.Equal(t, []string{"outer eth_old", "inner eth_new"}, calls)
+
+	assert.Equal(t, etherr.Nil, p.Call(&result, "eth_missing"))
+
+	raw, err := p.CallRaw("eth_blockNumber")
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), `"result":"eth_blockNumber"`)
+
+	assert.NoError(t, p.Subscribe(make(chan *json.RawMessage), "eth_subscribe", "newHeads"))
+	assert.Equal(t, "newHeads", e.subscribed)
+}
+
+func TestDebugLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &out
+	logger.Level = logrus.DebugLevel
+
+	p := Chain(&echo{}, DebugLogger(logger))
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+
+	assert.Contains(t, out.String(), "method=eth_blockNumber")
+	assert.Contains(t, out.String(), `\"result\":\"eth_blockNumber\"`)
+}
+
+// batchEcho is an echo sending batches, it counts them
+type batchEcho struct {
+	echo
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (e *batchEcho) CallBatch(batch []*BatchElem) error {
+	var methods []string
+	for _, elem := range batch {
+		methods = append(methods, elem.Method)
+	}
+	e.mu.Lock()
+	e.batches = append(e.batches, methods)
+	e.mu.Unlock()
+	callEach(&e.echo, batch)
+	return nil
+}
+
+func TestChain_CallBatch(t *testing.T) {
+	// eth_cached is answered on the way, eth_twice reaches the provider twice
+	intercept := func(next Handler) Handler {
+		return func(req *Request) ([]byte, error) {
+			switch req.Method {
+			case "eth_cached":
+				return []byte(`{"jsonrpc":"2.0","id":"1","result":"cached"}`), nil
+			case "eth_twice":
+				next(req)
+			}
+			return next(req)
+		}
+	}
+
+	e := &batchEcho{}
+	p := Chain(e, intercept)
+	var a, b, c, d string
+	batch := []*BatchElem{
+		{Method: "eth_a", Result: &a},
+		{Method: "eth_cached", Result: &b},
+		{Method: "eth_twice", Result: &c},
+		{Method: "eth_b", Result: &d},
+	}
+	assert.NoError(t, CallBatch(p, batch))
+
+	for _, elem := range batch {
+		assert.NoError(t, elem.Error)
+	}
+	assert.Equal(t, []string{"eth_a", "cached", "eth_twice", "eth_b"}, []string{a, b, c, d})
+	if assert.Len(t, e.batches, 1) {
+		assert.ElementsMatch(t, []string{"eth_a", "eth_twice", "eth_b"}, e.batches[0])
+	}
+}
+
+func TestChain_CallBatchSerialized(t *testing.T) {
+	// the calls go through one at a time, they can not all wait for the batch
+	var mu sync.Mutex
+	serialize := func(next Handler) Handler {
+		return func(req *Request) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return next(req)
+		}
+	}
+
+	e := &batchEcho{}
+	p := Chain(e, serialize)
+	var a, b, c string
+	batch := []*BatchElem{
+		{Method: "eth_a", Result: &a},
+		{Method: "eth_b", Result: &b},
+		{Method: "eth_c", Result: &c},
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- CallBatch(p, batch)
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch deadlocked")
+	}
+
+	assert.Equal(t, []string{"eth_a", "eth_b", "eth_c"}, []string{a, b, c})
+	assert.Len(t, e.batches, 3)
+}
@@ -0,0 +1,347 @@
+// Package ipcrpc talks json rpc over the unix domain socket of a local node (geth.ipc)
+package ipcrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/jsonrpc2"
+	"github.com/alethio/web3-go/logger"
+)
+
+// time allowed to write a message to the node
+const writeWait = 60 * time.Second
+
+// DefaultCallTimeout is the time a call waits for its response
+const DefaultCallTimeout = 60 * time.Second
+
+// Scheme is the url scheme of ipc endpoints, ipc:///path/to/geth.ipc
+const Scheme = "ipc://"
+
+// IPCProvider sends json rpc messages over a unix socket. Messages are json
+// values written one after the other, the node does not need newlines between them.
+type IPCProvider struct {
+	path        string
+	log         logger.Logger
+	callTimeout time.Duration
+	maxQueued   int
+	writeMu     sync.Mutex
+
+	mu      sync.Mutex
+	session *session
+}
+
+// session is the state of one connection, it dies with it
+type session struct {
+	conn          net.Conn
+	cancel        chan struct{}
+	dead          bool
+	cause         error
+	pending       *provider.Pending
+	subscriptions map[string]*subscription
+}
+
+// subscription hands the notifications of a subscription and its errors to the subscriber
+type subscription struct {
+	method   string
+	delivery *provider.Delivery
+}
+
+// IsPath tells if u designates an ipc endpoint: an ipc:// url or a filesystem path
+func IsPath(u string) bool {
+	return strings.HasPrefix(u, Scheme) ||
+		strings.HasPrefix(u, "/") ||
+		strings.HasPrefix(u, ".") ||
+		strings.HasSuffix(u, ".ipc")
+}
+
+// New creates a provider for the socket at path, ipc:// urls are accepted as well
+func New(path string, opts ...Option) (*IPCProvider, error) {
+	path = strings.TrimPrefix(path, Scheme)
+	if path == "" {
+		return nil, fmt.Errorf("Socket path can not be empty")
+	}
+
+	p := &IPCProvider{
+		path:        path,
+		log:         logger.Default(),
+		callTimeout: DefaultCallTimeout,
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Start connects to the socket and starts reading the responses, it does nothing while
+// the connection is alive
+func (p *IPCProvider) Start() error {
+	if p.alive() {
+		return nil
+	}
+
+	p.log.Debugf("connecting to %s", p.path)
+	c, err := net.Dial("unix", p.path)
+	if err != nil {
+		return err
+	}
+
+	s := &session{
+		conn:          c,
+		cancel:        make(chan struct{}),
+		pending:       provider.NewPending(p.log),
+		subscriptions: make(map[string]*subscription),
+	}
+	p.mu.Lock()
+	if p.session != nil && !p.session.dead {
+		// another Start connected meanwhile
+		p.mu.Unlock()
+		c.Close()
+		return nil
+	}
+	p.session = s
+	p.mu.Unlock()
+
+	go p.readLoop(s)
+	return nil
+}
+
+func (p *IPCProvider) alive() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.session != nil && !p.session.dead
+}
+
+// Stop closes the connection, ongoing requests fail and subscriptions are closed
+func (p *IPCProvider) Stop() {
+	p.mu.Lock()
+	s := p.session
+	p.mu.Unlock()
+	if s != nil {
+		p.fatality(s, etherr.ConnectionClosed)
+	}
+}
+
+// CallRaw calls a RPC method and returns the raw result
+func (p *IPCProvider) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	resp, _, err := p.call(method, params)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Raw, nil
+}
+
+// Call calls a RPC method and returns coresponding object
+func (p *IPCProvider) Call(result interface{}, method string, params ...interface{}) error {
+	resp, _, err := p.call(method, params)
+	if err != nil {
+		return err
+	}
+	return provider.DecodeResult(resp, result)
+}
+
+// Subscribe creates a subscription to event using method. Notifications are delivered
+// in order, a receiver that is not drained only holds back its own subscription; it is
+// ended with etherr.SubscriptionOverflow once its queue is full, see WithMaxQueued.
+func (p *IPCProvider) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	return p.SubscribeErr(receiver, nil, method, event, params...)
+}
+
+// SubscribeErr is Subscribe with errs receiving the errors of the subscription, see provider.ErrSubscriber
+func (p *IPCProvider) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	pa := append([]interface{}{}, event)
+	pa = append(pa, params...)
+
+	resp, s, err := p.call(method, pa)
+	if err != nil {
+		return fmt.Errorf("subscription creation: %s", err)
+	}
+	var subscriptionID string
+	if err := provider.DecodeResult(resp, &subscriptionID); err != nil {
+		return fmt.Errorf("subscription creation: %s", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// the connection died while subscribing
+	if s.subscriptions == nil {
+		return fmt.Errorf("subscription creation: %s", etherr.ConnectionClosed)
+	}
+	s.subscriptions[subscriptionID] = &subscription{
+		method:   method,
+		delivery: provider.NewDelivery(receiver, errs, nil, p.maxQueued),
+	}
+
+	return nil
+}
+
+// CallBatch sends the calls in a single message
+func (p *IPCProvider) CallBatch(batch []*provider.BatchElem) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	requests := provider.BatchRequests(batch)
+	payload, err := jsonrpc2.EncodeClientRequests(requests)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(requests))
+	for i, r := range requests {
+		ids[i] = r.ID
+	}
+
+	responses, _, err := p.send(ids, payload, true)
+	if err != nil {
+		return err
+	}
+	provider.DecodeBatch(batch, requests, responses)
+	return nil
+}
+
+// call sends a request and waits for its response, it returns the session that answered
+func (p *IPCProvider) call(method string, params []interface{}) (*jsonrpc2.JSONRPCMessage, *session, error) {
+	id := jsonrpc2.NextID()
+	request, err := jsonrpc2.EncodeClientRequest(method, params, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("call: %s", err)
+	}
+
+	responses, s, err := p.send([]string{id}, request, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return responses[0], s, nil
+}
+
+// send writes a message and waits for the responses to ids, until the connection dies or
+// the call timeout. A batch ends with the array answering it, the requests left out get no
+// response; a batch rejected as a whole fails with the error of the node.
+func (p *IPCProvider) send(ids []string, message []byte, batch bool) ([]*jsonrpc2.JSONRPCMessage, *session, error) {
+	p.mu.Lock()
+	s := p.session
+	if s == nil || s.dead {
+		p.mu.Unlock()
+		return nil, nil, etherr.ConnectionClosed
+	}
+	p.mu.Unlock()
+
+	responses, err := s.pending.Exchange(ids, batch, s.cancel, p.callTimeout, func(<-chan time.Time) error {
+		if err := p.write(s.conn, message); err != nil {
+			p.log.Debugf("message write error: %s", err)
+			p.fatality(s, etherr.ConnectionLost(err))
+			return etherr.ConnectionClosed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return responses, s, nil
+}
+
+// write sends one message followed by a newline, one writer at a time
+func (p *IPCProvider) write(c net.Conn, message []byte) error {
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+
+	c.SetWriteDeadline(time.Now().Add(writeWait))
+	_, err := c.Write(append(bytes.TrimRight(message, "\n"), '\n'))
+	return err
+}
+
+// readLoop decodes the stream of json values sent by the node until the connection dies.
+// It queues the notifications of the subscriptions, never waiting for their receivers, and
+// ends them with the cause when it ends.
+func (p *IPCProvider) readLoop(s *session) {
+	dec := json.NewDecoder(s.conn)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			if err != io.EOF {
+				p.log.Debugf("message read error: %s", err)
+			}
+			p.fatality(s, etherr.ConnectionLost(err))
+			break
+		}
+
+		s.pending.Receive(raw, func(msg *jsonrpc2.JSONRPCMessage) {
+			p.handleMessage(s, msg)
+		})
+	}
+
+	p.mu.Lock()
+	subscriptions := s.subscriptions
+	s.subscriptions = nil
+	cause := s.cause
+	p.mu.Unlock()
+	for _, sub := range subscriptions {
+		sub.delivery.End(cause)
+	}
+}
+
+func (p *IPCProvider) handleMessage(s *session, msg *jsonrpc2.JSONRPCMessage) {
+	switch {
+	case msg.IsNotification():
+		if !strings.HasSuffix(msg.Method, "_subscription") {
+			p.log.Warnf("dropping non-subscription message: %s", msg)
+			return
+		}
+		var notification jsonrpc2.JSONRPCNotification
+		if err := json.Unmarshal(msg.Params, &notification); err != nil {
+			p.log.Warnf("dropping invalid subscription message: %s", msg)
+			return
+		}
+		id, err := notification.ValidID()
+		if err != nil {
+			p.log.Warnf("notification json id: %s", err)
+			return
+		}
+
+		p.mu.Lock()
+		sub, ok := s.subscriptions[id]
+		p.mu.Unlock()
+		if !ok {
+			return
+		}
+		if notification.Error != nil {
+			sub.delivery.Err(etherr.New(notification.Error.Message, notification.Error.Code, notification.Error.Data))
+			return
+		}
+		if !sub.delivery.Notify(&notification.Result) {
+			p.log.Warnf("subscription %s overflowed, terminating it", id)
+			p.mu.Lock()
+			delete(s.subscriptions, id)
+			p.mu.Unlock()
+			// the read loop can not wait for the answer it has to read itself
+			go p.Call(new(bool), strings.Replace(sub.method, "_subscribe", "_unsubscribe", 1), id)
+		}
+
+	default:
+		p.log.Warnf("message not handled: %s", msg.String())
+	}
+}
+
+// fatality closes the connection of s and fails its ongoing requests, the first cause
+// is the one handed to the subscriptions
+func (p *IPCProvider) fatality(s *session, cause error) {
+	p.mu.Lock()
+	if !s.dead {
+		s.dead = true
+		s.cause = cause
+		close(s.cancel)
+	}
+	p.mu.Unlock()
+
+	_ = s.conn.Close()
+}
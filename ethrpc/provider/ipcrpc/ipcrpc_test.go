@@ -0,0 +1,252 @@
+package ipcrpc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/rpctest"
+)
+
+func newServer(t *testing.T) (*rpctest.Server, string, func()) {
+	dir, err := ioutil.TempDir("", "ipcrpc")
+	assert.NoError(t, err)
+
+	srv := rpctest.NewServer()
+	path := filepath.Join(dir, "geth.ipc")
+	assert.NoError(t, srv.ListenUnix(path))
+	return srv, path, func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestIsPath(t *testing.T) {
+	assert.True(t, IsPath("ipc:///tmp/geth.ipc"))
+	assert.True(t, IsPath("/home/eth/.ethereum/geth.ipc"))
+	assert.True(t, IsPath("./geth.ipc"))
+	assert.True(t, IsPath("geth.ipc"))
+	assert.False(t, IsPath("http://localhost:8545"))
+	assert.False(t, IsPath("ws://localhost:8546"))
+}
+
+func TestIPCProvider_Call(t *testing.T) {
+	srv, path, done := newServer(t)
+	defer done()
+	srv.Handle("eth_blockNumber", "0x10")
+	srv.HandleError("eth_call", -32015, "VM execution error.")
+
+	p, err := New("ipc://" + path)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var result string
+			assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+			assert.Equal(t, "0x10", result)
+		}()
+	}
+	wg.Wait()
+
+	raw, err := p.CallRaw("eth_blockNumber")
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), `"result":"0x10"`)
+
+	var result string
+	assert.Equal(t, etherr.VMExecutionError, p.Call(&result, "eth_call", map[string]string{}, "latest"))
+}
+
+func TestIPCProvider_Subscribe(t *testing.T) {
+	srv, path, done := newServer(t)
+	defer done()
+
+	p, err := New(path)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	receiver := make(chan *json.RawMessage, 1)
+	assert.NoError(t, p.Subscribe(receiver, "eth_subscribe", "newHeads"))
+
+	for _, n := range []string{"0x1", "0x2", "0x3"} {
+		_, err := srv.Notify("newHeads", n)
+		assert.NoError(t, err)
+	}
+	for _, n := range []string{"0x1", "0x2", "0x3"} {
+		assert.Equal(t, `"`+n+`"`, string(*<-receiver))
+	}
+
+	srv.DropConnections()
+	_, open := <-receiver
+	assert.False(t, open)
+
+	var result string
+	assert.Equal(t, etherr.ConnectionClosed, p.Call(&result, "eth_blockNumber"))
+}
+
+func TestIPCProvider_StartTwice(t *testing.T) {
+	srv, path, done := newServer(t)
+	defer done()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	p, err := New(path)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	// the live connection is kept
+	s := p.session
+	assert.NoError(t, p.Start())
+	assert.True(t, s == p.session)
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+
+	// a dead one is replaced
+	p.Stop()
+	assert.NoError(t, p.Start())
+	assert.False(t, s == p.session)
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+}
+
+func TestIPCProvider_SlowSubscriber(t *testing.T) {
+	srv, path, done := newServer(t)
+	defer done()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	p, err := New(path)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	// nobody reads the receiver while the notifications come
+	receiver := make(chan *json.RawMessage)
+	assert.NoError(t, p.Subscribe(receiver, "eth_subscribe", "newHeads"))
+	for i := 0; i < 10; i++ {
+		_, err := srv.Notify("newHeads", i)
+		assert.NoError(t, err)
+	}
+
+	// the responses do not wait behind them
+	called := make(chan error, 1)
+	go func() {
+		var result string
+		called <- p.Call(&result, "eth_blockNumber")
+	}()
+	select {
+	case err := <-called:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("call held back by the subscriber")
+	}
+
+	for i := 0; i < 10; i++ {
+		var n int
+		assert.NoError(t, json.Unmarshal(*<-receiver, &n))
+		assert.Equal(t, i, n)
+	}
+}
+
+func TestIPCProvider_MaxQueued(t *testing.T) {
+	srv, path, done := newServer(t)
+	defer done()
+
+	p, err := New(path, WithMaxQueued(3))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	// nobody reads the receiver, its queue fills up
+	receiver := make(chan *json.RawMessage)
+	errs := make(chan error, 1)
+	assert.NoError(t, p.SubscribeErr(receiver, errs, "eth_subscribe", "newHeads"))
+	for i := 0; i < 10; i++ {
+		_, err := srv.Notify("newHeads", i)
+		assert.NoError(t, err)
+	}
+
+	select {
+	case err := <-errs:
+		assert.Equal(t, etherr.SubscriptionOverflow, err)
+	case <-time.After(time.Second):
+		t.Fatal("subscription not ended")
+	}
+	_, ok := <-receiver
+	assert.False(t, ok)
+
+	// the node is told to stop sending
+	deadline := time.Now().Add(time.Second)
+	for srv.Subscriptions("newHeads") > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, srv.Subscriptions("newHeads"))
+
+	_, err = New(path, WithMaxQueued(0))
+	assert.Error(t, err)
+}
+
+func TestIPCProvider_CallBatch(t *testing.T) {
+	srv, path, done := newServer(t)
+	defer done()
+	srv.Handle("eth_blockNumber", "0x10")
+	srv.Handle("eth_chainId", "0x1")
+	srv.ReverseBatches(true)
+
+	p, err := New(path)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	var number, chain string
+	batch := []*provider.BatchElem{
+		{Method: "eth_blockNumber", Result: &number},
+		{Method: "eth_chainId", Result: &chain},
+		{Method: "eth_missing", Result: new(string)},
+	}
+	assert.NoError(t, p.CallBatch(batch))
+	assert.NoError(t, batch[0].Error)
+	assert.NoError(t, batch[1].Error)
+	assert.Error(t, batch[2].Error)
+	assert.Equal(t, "0x10", number)
+	assert.Equal(t, "0x1", chain)
+}
+
+func TestIPCProvider_CallTimeout(t *testing.T) {
+	srv, path, done := newServer(t)
+	defer done()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	p, err := New(path, WithCallTimeout(30*time.Millisecond))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	srv.SetLatency(100 * time.Millisecond)
+	var result string
+	assert.Equal(t, etherr.RequestTimeout, p.Call(&result, "eth_blockNumber"))
+
+	// the late response is dropped, the connection goes on
+	time.Sleep(150 * time.Millisecond)
+	srv.SetLatency(0)
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, "0x10", result)
+
+	_, err = New(path, WithCallTimeout(0))
+	assert.Error(t, err)
+
+	p, err = New(path)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultCallTimeout, p.callTimeout)
+}
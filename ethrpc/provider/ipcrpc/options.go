@@ -0,0 +1,46 @@
+package ipcrpc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alethio/web3-go/logger"
+)
+
+// Option configures an IPCProvider when it is created
+type Option func(p *IPCProvider) error
+
+// WithLogger sets the logger of the connection events, logger.Default otherwise
+func WithLogger(l logger.Logger) Option {
+	return func(p *IPCProvider) error {
+		if l == nil {
+			return fmt.Errorf("Logger can not be nil, use logger.Nop to discard the logs")
+		}
+		p.log = l
+		return nil
+	}
+}
+
+// WithCallTimeout sets the time a call waits for its response, DefaultCallTimeout otherwise.
+// The response of a call that timed out is dropped when it comes.
+func WithCallTimeout(d time.Duration) Option {
+	return func(p *IPCProvider) error {
+		if d <= 0 {
+			return fmt.Errorf("Call timeout must be positive")
+		}
+		p.callTimeout = d
+		return nil
+	}
+}
+
+// WithMaxQueued sets the number of notifications a subscription queues while its receiver
+// is full, provider.DefaultMaxQueued otherwise. The subscription is ended past it.
+func WithMaxQueued(n int) Option {
+	return func(p *IPCProvider) error {
+		if n <= 0 {
+			return fmt.Errorf("Queue size must be positive")
+		}
+		p.maxQueued = n
+		return nil
+	}
+}
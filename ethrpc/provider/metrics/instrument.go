@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/ethrpc/provider/wsrpc"
+	"github.com/alethio/web3-go/jsonrpc2"
+)
+
+// DefaultBatchBuckets are the upper bounds of the batch size histogram
+var DefaultBatchBuckets = []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}
+
+// Interceptor counts the requests, their latency and their errors per method.
+// Errors are labelled with the json rpc error code, http_<status> for http
+// errors and transport for everything else.
+func Interceptor(r *Registry) provider.Interceptor {
+	requests := r.Counter("web3_rpc_requests_total", "Number of json rpc requests.", "method")
+	errors := r.Counter("web3_rpc_errors_total", "Number of failed json rpc requests.", "method", "code")
+	latency := r.Histogram("web3_rpc_request_duration_seconds", "Time taken by the json rpc requests.", DefaultLatencyBuckets, "method")
+
+	return func(next provider.Handler) provider.Handler {
+		return func(req *provider.Request) ([]byte, error) {
+			start := time.Now()
+			raw, err := next(req)
+
+			requests.Inc(req.Method)
+			latency.Observe(time.Since(start).Seconds(), req.Method)
+			if code, failed := errorCode(raw, err); failed {
+				errors.Inc(req.Method, code)
+			}
+			return raw, err
+		}
+	}
+}
+
+// errorCode returns the label of the error of a request, if it failed
+func errorCode(raw []byte, err error) (string, bool) {
+	if err != nil {
+		switch e := err.(type) {
+		case *etherr.RpcError:
+			return strconv.Itoa(e.Code), true
+		case *etherr.HTTPError:
+			return "http_" + strconv.Itoa(e.StatusCode), true
+		}
+		return "transport", true
+	}
+
+	// subscriptions have no response
+	if raw == nil {
+		return "", false
+	}
+	resp, decodeErr := jsonrpc2.DecodeResponse(raw)
+	if decodeErr != nil {
+		return "decode", true
+	}
+	if resp.Error != nil {
+		return strconv.Itoa(resp.Error.Code), true
+	}
+	return "", false
+}
+
+// InstrumentBatchLoader records the size of the batches sent by the loader
+func InstrumentBatchLoader(r *Registry, l *httprpc.BatchLoader) {
+	sizes := r.Histogram("web3_rpc_batch_size", "Number of json rpc requests per batch.", DefaultBatchBuckets)
+	l.SetBatchObserver(func(size int) {
+		sizes.Observe(float64(size))
+	})
+}
+
+// InstrumentWS exposes the state of a websocket provider, name tells providers apart
+func InstrumentWS(r *Registry, name string, p *wsrpc.WSProvider) {
+	labels := Labels{"provider": name}
+
+	r.CounterFunc("web3_ws_reconnects_total", "Number of websocket reconnections.", labels, func() float64 {
+		return float64(p.Stats().Reconnects)
+	})
+	r.GaugeFunc("web3_ws_pending_requests", "Number of requests waiting for their response.", labels, func() float64 {
+		return float64(p.Stats().PendingRequests)
+	})
+	r.GaugeFunc("web3_ws_subscriptions", "Number of active subscriptions.", labels, func() float64 {
+		return float64(p.Stats().Subscriptions)
+	})
+	r.GaugeFunc("web3_ws_subscription_backlog", "Number of notifications waiting in the subscription channels.", labels, func() float64 {
+		return float64(p.Stats().SubscriptionBacklog)
+	})
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/ethrpc/provider/wsrpc"
+	"github.com/alethio/web3-go/rpctest"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("calls_total", "Calls.", "method")
+	c.Inc("b")
+	c.Add(2, "a")
+	h := r.Histogram("latency_seconds", "Latency.", []float64{1, 0.1}, "method")
+	h.Observe(0.05, "a")
+	h.Observe(0.5, "a")
+	r.GaugeFunc("depth", "Depth.", nil, func() float64 { return 3 })
+
+	var out bytes.Buffer
+	assert.NoError(t, r.WriteText(&out))
+	assert.Equal(t, `# HELP calls_total Calls.
+# TYPE calls_total counter
+calls_total{method="a"} 2
+calls_total{method="b"} 1
+# HELP depth Depth.
+# TYPE depth gauge
+depth 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="a",le="0.1"} 1
+latency_seconds_bucket{method="a",le="1"} 2
+latency_seconds_bucket{method="a",le="+Inf"} 2
+latency_seconds_sum{method="a"} 0.55
+latency_seconds_count{method="a"} 2
+`, out.String())
+}
+
+func TestRegistry_LabelEscaping(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("calls_total", "Calls.", "method").Inc("a\\b \"c\"\nd \t é")
+
+	var out bytes.Buffer
+	assert.NoError(t, r.WriteText(&out))
+	// only backslashes, quotes and line feeds are escaped, unlike go strings
+	assert.Contains(t, out.String(), `calls_total{method="a\\b \"c\"\nd `+"\t é\"} 1\n")
+}
+
+func TestInterceptor(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+	srv.HandleError("eth_call", -32015, "VM execution error.")
+
+	loader, err := httprpc.NewBatchLoader(10, 5*time.Millisecond)
+	assert.NoError(t, err)
+	h, err := httprpc.NewWithLoader(srv.URL, loader)
+	assert.NoError(t, err)
+
+	r := NewRegistry()
+	InstrumentBatchLoader(r, loader)
+	p := provider.Chain(h, Interceptor(r))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var result string
+			p.Call(&result, "eth_blockNumber")
+		}()
+	}
+	wg.Wait()
+	var result string
+	assert.Error(t, p.Call(&result, "eth_call", map[string]string{}, "latest"))
+	srv.FailNext(503)
+	assert.Error(t, p.Call(&result, "eth_blockNumber"))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+
+	assert.Contains(t, out, `web3_rpc_requests_total{method="eth_blockNumber"} 4`)
+	assert.Contains(t, out, `web3_rpc_errors_total{method="eth_call",code="-32015"} 1`)
+	assert.Contains(t, out, `web3_rpc_errors_total{method="eth_blockNumber",code="http_503"} 1`)
+	assert.Contains(t, out, `web3_rpc_request_duration_seconds_count{method="eth_call"} 1`)
+	assert.Contains(t, out, `web3_rpc_batch_size_bucket{le="5"} 3`)
+	assert.Contains(t, out, `web3_rpc_batch_size_count 3`)
+}
+
+func TestInstrumentWS(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+
+	p, err := wsrpc.New(srv.WSURL, false)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	receiver := make(chan *json.RawMessage, 2)
+	assert.NoError(t, p.Subscribe(receiver, "eth_subscribe", "newHeads"))
+	srv.Notify("newHeads", "0x1")
+	srv.Notify("newHeads", "0x2")
+
+	r := NewRegistry()
+	InstrumentWS(r, "node", p)
+
+	var out bytes.Buffer
+	for i := 0; i < 1000 && !strings.Contains(out.String(), `web3_ws_subscription_backlog{provider="node"} 2`); i++ {
+		time.Sleep(time.Millisecond)
+		out.Reset()
+		r.WriteText(&out)
+	}
+	assert.Contains(t, out.String(), `web3_ws_subscription_backlog{provider="node"} 2`)
+	assert.Contains(t, out.String(), `web3_ws_subscriptions{provider="node"} 1`)
+	assert.Contains(t, out.String(), `web3_ws_reconnects_total{provider="node"} 0`)
+
+	<-receiver
+	<-receiver
+}
@@ -0,0 +1,292 @@
+// Package metrics counts the rpc traffic of the providers and serves it in the
+// Prometheus text format, using only the standard library
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the upper bounds in seconds of the latency histograms
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Labels are constant labels attached to a metric
+type Labels map[string]string
+
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	counters   map[string]*counter
+	histograms map[string]*histogram
+	funcs      map[string]func() float64
+	buckets    []float64
+}
+
+type counter struct {
+	value float64
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Registry holds the metrics and writes them in the Prometheus text format
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// CounterVec is a counter with one value per combination of label values
+type CounterVec struct {
+	r *Registry
+	f *family
+}
+
+// HistogramVec is a histogram with one distribution per combination of label values
+type HistogramVec struct {
+	r *Registry
+	f *family
+}
+
+// Counter returns the counter called name, creating it with the label names if needed
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r, r.family(name, help, "counter", labels, nil)}
+}
+
+// Histogram returns the histogram called name, creating it with the buckets and
+// label names if needed
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &HistogramVec{r, r.family(name, help, "histogram", labels, b)}
+}
+
+// GaugeFunc registers a gauge whose value is read from f when the metrics are written
+func (r *Registry) GaugeFunc(name, help string, labels Labels, f func() float64) {
+	r.function(name, help, "gauge", labels, f)
+}
+
+// CounterFunc registers a counter whose value is read from f when the metrics are written
+func (r *Registry) CounterFunc(name, help string, labels Labels, f func() float64) {
+	r.function(name, help, "counter", labels, f)
+}
+
+func (r *Registry) function(name, help, kind string, labels Labels, f func() float64) {
+	names := make([]string, 0, len(labels))
+	for n := range labels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	values := make([]string, len(names))
+	for i, n := range names {
+		values[i] = labels[n]
+	}
+
+	fam := r.family(name, help, kind, names, nil)
+	r.mu.Lock()
+	fam.funcs[series(names, values)] = f
+	r.mu.Unlock()
+}
+
+func (r *Registry) family(name, help, kind string, labels []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		return f
+	}
+	f := &family{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labels:     labels,
+		counters:   make(map[string]*counter),
+		histograms: make(map[string]*histogram),
+		funcs:      make(map[string]func() float64),
+		buckets:    buckets,
+	}
+	r.families[name] = f
+	return f
+}
+
+// Inc adds one to the counter of the label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v to the counter of the label values
+func (c *CounterVec) Add(v float64, values ...string) {
+	k := series(c.f.labels, values)
+
+	c.r.mu.Lock()
+	s, ok := c.f.counters[k]
+	if !ok {
+		s = &counter{}
+		c.f.counters[k] = s
+	}
+	s.value += v
+	c.r.mu.Unlock()
+}
+
+// Observe adds v to the distribution of the label values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	k := series(h.f.labels, values)
+
+	h.r.mu.Lock()
+	s, ok := h.f.histograms[k]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.f.buckets))}
+		h.f.histograms[k] = s
+	}
+	for i, upper := range h.f.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+	h.r.mu.Unlock()
+}
+
+// WriteText writes every metric in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	// gauge functions may take locks of their own, they are read outside of ours
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	type snapshot struct {
+		f       *family
+		lines   []string
+		funcs   map[string]func() float64
+		ordered []string
+	}
+	snapshots := make([]snapshot, len(names))
+	for i, name := range names {
+		f := r.families[name]
+		s := snapshot{f: f, funcs: make(map[string]func() float64)}
+
+		for _, k := range sortedKeys(f.counters) {
+			s.lines = append(s.lines, fmt.Sprintf("%s%s %s", f.name, k, number(f.counters[k].value)))
+		}
+		for _, k := range sortedKeys(f.histograms) {
+			h := f.histograms[k]
+			for j, upper := range f.buckets {
+				s.lines = append(s.lines, fmt.Sprintf("%s_bucket%s %d", f.name, withLabel(k, "le", number(upper)), h.counts[j]))
+			}
+			s.lines = append(s.lines,
+				fmt.Sprintf("%s_bucket%s %d", f.name, withLabel(k, "le", "+Inf"), h.count),
+				fmt.Sprintf("%s_sum%s %s", f.name, k, number(h.sum)),
+				fmt.Sprintf("%s_count%s %d", f.name, k, h.count))
+		}
+		for k, fn := range f.funcs {
+			s.funcs[k] = fn
+			s.ordered = append(s.ordered, k)
+		}
+		sort.Strings(s.ordered)
+		snapshots[i] = s
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, s := range snapshots {
+		fmt.Fprintf(bw, "# HELP %s %s\n", s.f.name, escapeHelp(s.f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", s.f.name, s.f.kind)
+		for _, line := range s.lines {
+			fmt.Fprintln(bw, line)
+		}
+		for _, k := range s.ordered {
+			fmt.Fprintf(bw, "%s%s %s\n", s.f.name, k, number(s.funcs[k]()))
+		}
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WriteText(w)
+}
+
+// series formats label pairs as {a="1",b="2"}, empty without labels
+func series(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		pairs[i] = n + `="` + escape(v) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func withLabel(series, name, value string) string {
+	pair := name + `="` + escape(value) + `"`
+	if series == "" {
+		return "{" + pair + "}"
+	}
+	return series[:len(series)-1] + "," + pair + "}"
+}
+
+// labelEscaper escapes label values as the text format wants, only backslashes, double
+// quotes and line feeds
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*counter:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*histogram:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func number(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
@@ -0,0 +1,222 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/jsonrpc2"
+	"github.com/alethio/web3-go/logger"
+)
+
+// Pending matches the responses read from a connection with the requests waiting for
+// them, for the transports sharing one connection between all the calls: websockets and
+// ipc. A node answers a batch with a single array, or rejects it as a whole with an error
+// without id, batches being answered in order.
+type Pending struct {
+	log logger.Logger
+
+	mu       sync.Mutex
+	requests map[string]chan *jsonrpc2.JSONRPCMessage
+	batches  []*pendingBatch
+}
+
+// pendingBatch is a batch waiting for its responses, in the order the batches were sent
+type pendingBatch struct {
+	ids      []string
+	receiver chan *jsonrpc2.JSONRPCMessage
+}
+
+// NewPending creates the bookkeeping of a connection, nil log logs to logger.Default
+func NewPending(log logger.Logger) *Pending {
+	if log == nil {
+		log = logger.Default()
+	}
+	return &Pending{
+		log:      log,
+		requests: make(map[string]chan *jsonrpc2.JSONRPCMessage),
+	}
+}
+
+// Exchange sends a message with send and waits for the responses to ids, until cancel is
+// closed or timeout. send gets the deadline, for transports which may wait to send. A
+// batch ends with the array answering it, the requests left out get no response; a batch
+// rejected as a whole fails with the error of the node.
+func (p *Pending) Exchange(ids []string, batch bool, cancel <-chan struct{}, timeout time.Duration, send func(deadline <-chan time.Time) error) ([]*jsonrpc2.JSONRPCMessage, error) {
+	// buffered so the reader never waits for a caller
+	receiver := make(chan *jsonrpc2.JSONRPCMessage, len(ids))
+	var pending *pendingBatch
+	p.mu.Lock()
+	for _, id := range ids {
+		p.requests[id] = receiver
+	}
+	if batch {
+		pending = &pendingBatch{ids: ids, receiver: receiver}
+		p.batches = append(p.batches, pending)
+	}
+	p.mu.Unlock()
+	// the responses coming after the caller gave up are dropped by Receive
+	defer p.forget(ids, pending)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	if err := send(timer.C); err != nil {
+		return nil, err
+	}
+
+	responses := make([]*jsonrpc2.JSONRPCMessage, 0, len(ids))
+	for len(responses) < len(ids) {
+		select {
+		case resp := <-receiver:
+			if resp == nil {
+				// the rest of the batch is missing from the array answering it
+				return responses, nil
+			}
+			if !resp.HasValidID() {
+				return nil, etherr.New(resp.Error.Message, resp.Error.Code, resp.Error.Data)
+			}
+			responses = append(responses, resp)
+		case <-cancel:
+			return nil, etherr.ConnectionClosed
+		case <-timer.C:
+			return nil, etherr.RequestTimeout
+		}
+	}
+	return responses, nil
+}
+
+// Receive hands the responses in message, a single one or the array answering a batch,
+// to the requests waiting for them. The other messages, like notifications, go to handle.
+func (p *Pending) Receive(message []byte, handle func(msg *jsonrpc2.JSONRPCMessage)) {
+	messages := []json.RawMessage{message}
+	batch := bytes.HasPrefix(bytes.TrimSpace(message), []byte("["))
+	if batch {
+		responses, err := jsonrpc2.DecodeResponses(message)
+		if err != nil {
+			p.log.Warnf("decode rpc batch: %s", err)
+			return
+		}
+		messages = responses
+	}
+
+	answered := make(map[string]bool)
+	for _, m := range messages {
+		msg, err := jsonrpc2.DecodeResponse(m)
+		if err != nil {
+			p.log.Warnf("decode rpc message: %s", err)
+			continue
+		}
+		if !batch && msg.ID == "" && msg.Error != nil && p.batchRejected(msg) {
+			continue
+		}
+		answered[msg.ID] = true
+		if !msg.IsResponse() {
+			handle(msg)
+			continue
+		}
+		p.respond(msg)
+	}
+	if batch {
+		p.batchAnswered(answered)
+	}
+}
+
+// Len returns the number of requests waiting for their response
+func (p *Pending) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.requests)
+}
+
+func (p *Pending) respond(msg *jsonrpc2.JSONRPCMessage) {
+	id, err := msg.ValidID()
+	if err != nil {
+		p.log.Warnf("response json id: %s", err)
+		return
+	}
+
+	p.mu.Lock()
+	c, ok := p.requests[id]
+	delete(p.requests, id)
+	p.mu.Unlock()
+
+	if !ok {
+		// the caller gave up on it, or the node answered something that was never asked
+		p.log.Debugf("dropping response to unknown request %s", id)
+		return
+	}
+	// the receivers are buffered for all their responses
+	c <- msg
+}
+
+// forget removes the requests that are no longer waited for, and their batch if any
+func (p *Pending) forget(ids []string, batch *pendingBatch) {
+	p.mu.Lock()
+	for _, id := range ids {
+		delete(p.requests, id)
+	}
+	p.removeBatch(batch)
+	p.mu.Unlock()
+}
+
+// removeBatch removes a batch from the pending ones, p.mu must be held
+func (p *Pending) removeBatch(batch *pendingBatch) {
+	for i, b := range p.batches {
+		if b == batch {
+			p.batches = append(p.batches[:i], p.batches[i+1:]...)
+			return
+		}
+	}
+}
+
+// batchAnswered ends the batches answered by an array holding the responses to ids, the
+// requests a node left out of the array will never get a response
+func (p *Pending) batchAnswered(ids map[string]bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := 0; i < len(p.batches); i++ {
+		b := p.batches[i]
+		answered := false
+		for _, id := range b.ids {
+			answered = answered || ids[id]
+		}
+		if !answered {
+			continue
+		}
+		p.removeBatch(b)
+		i--
+		for _, id := range b.ids {
+			delete(p.requests, id)
+		}
+		// the receiver has room unless every response was delivered
+		select {
+		case b.receiver <- nil:
+		default:
+		}
+	}
+}
+
+// batchRejected hands an error without id to the oldest batch waiting, it is how nodes
+// reject a batch as a whole, like geth's "batch too large"
+func (p *Pending) batchRejected(msg *jsonrpc2.JSONRPCMessage) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.batches) == 0 {
+		return false
+	}
+	b := p.batches[0]
+	p.batches = p.batches[1:]
+	for _, id := range b.ids {
+		delete(p.requests, id)
+	}
+	select {
+	case b.receiver <- msg:
+	default:
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/jsonrpc2"
+)
+
+func TestPending(t *testing.T) {
+	p := NewPending(nil)
+	var notified []string
+	receive := func(message string) {
+		p.Receive([]byte(message), func(msg *jsonrpc2.JSONRPCMessage) {
+			notified = append(notified, msg.Method)
+		})
+	}
+	exchange := func(ids []string, batch bool, answer string) ([]*jsonrpc2.JSONRPCMessage, error) {
+		return p.Exchange(ids, batch, nil, time.Second, func(<-chan time.Time) error {
+			go receive(answer)
+			return nil
+		})
+	}
+
+	responses, err := exchange([]string{"1"}, false, `{"jsonrpc":"2.0","id":"1","result":"0x1"}`)
+	assert.NoError(t, err)
+	assert.Len(t, responses, 1)
+
+	// the node left the second request out of the array
+	responses, err = exchange([]string{"2", "3"}, true, `[{"jsonrpc":"2.0","id":"2","result":"0x2"}]`)
+	assert.NoError(t, err)
+	assert.Len(t, responses, 1)
+
+	_, err = exchange([]string{"4", "5"}, true, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"batch too large"}}`)
+	if assert.IsType(t, &etherr.RpcError{}, err) {
+		assert.Equal(t, -32600, err.(*etherr.RpcError).Code)
+	}
+
+	receive(`{"jsonrpc":"2.0","method":"eth_subscription","params":{}}`)
+	assert.Equal(t, []string{"eth_subscription"}, notified)
+	assert.Equal(t, 0, p.Len())
+
+	// nobody answers
+	_, err = p.Exchange([]string{"6"}, false, nil, 10*time.Millisecond, func(<-chan time.Time) error { return nil })
+	assert.Equal(t, etherr.RequestTimeout, err)
+	assert.Equal(t, 0, p.Len())
+}
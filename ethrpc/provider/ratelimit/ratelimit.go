@@ -0,0 +1,171 @@
+// Package ratelimit keeps the calls made to a node under a request rate and a number
+// of requests in flight
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"golang.org/x/time/rate"
+
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/jsonrpc2"
+)
+
+// Limiter holds the budget shared by everything talking to the same node. Each RPC
+// costs the weight of its method, 1 unless configured otherwise.
+type Limiter struct {
+	limiter  *rate.Limiter
+	inFlight chan struct{}
+
+	mu      sync.RWMutex
+	weights map[string]int
+}
+
+// New creates a limiter allowing rps weighted RPCs per second with bursts up to burst,
+// and at most maxInFlight requests at the same time. 0 rps or maxInFlight means no limit.
+func New(rps float64, burst int, maxInFlight int) (*Limiter, error) {
+	if rps < 0 {
+		return nil, fmt.Errorf("Requests per second can not be negative")
+	}
+	if rps > 0 && burst < 1 {
+		return nil, fmt.Errorf("Burst must be at least 1")
+	}
+	if maxInFlight < 0 {
+		return nil, fmt.Errorf("Maximum requests in flight can not be negative")
+	}
+
+	l := &Limiter{weights: make(map[string]int)}
+	if rps > 0 {
+		l.limiter = rate.NewLimiter(rate.Limit(rps), burst)
+	}
+	if maxInFlight > 0 {
+		l.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return l, nil
+}
+
+// SetWeight sets the cost of a method, like the compute units of hosted providers
+func (l *Limiter) SetWeight(method string, weight int) {
+	l.mu.Lock()
+	l.weights[method] = weight
+	l.mu.Unlock()
+}
+
+// SetWeights sets the cost of several methods at once
+func (l *Limiter) SetWeights(weights map[string]int) {
+	l.mu.Lock()
+	for method, weight := range weights {
+		l.weights[method] = weight
+	}
+	l.mu.Unlock()
+}
+
+// Weight returns the cost of a method
+func (l *Limiter) Weight(method string) int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if w, ok := l.weights[method]; ok {
+		return w
+	}
+	return 1
+}
+
+// Acquire blocks until the requests can be sent as one round trip. A batch takes one
+// in flight slot but is charged the weight of every RPC it holds.
+// The returned function must be called once the response arrived.
+// Acquire implements httprpc.Throttle.
+func (l *Limiter) Acquire(reqs []*jsonrpc2.JSONRPCRequest) func() {
+	n := 0
+	for _, req := range reqs {
+		n += l.Weight(req.Method)
+	}
+	return l.acquire(n)
+}
+
+func (l *Limiter) acquire(n int) func() {
+	if l.limiter != nil {
+		// WaitN refuses more than the burst, so bigger costs are paid in parts
+		burst := l.limiter.Burst()
+		for n > 0 {
+			part := n
+			if part > burst {
+				part = burst
+			}
+			l.limiter.WaitN(context.Background(), part)
+			n -= part
+		}
+	}
+
+	if l.inFlight == nil {
+		return func() {}
+	}
+	l.inFlight <- struct{}{}
+	return func() {
+		<-l.inFlight
+	}
+}
+
+// Provider limits the calls made through the wrapped provider. For http providers
+// using a BatchLoader prefer setting the limiter as throttle, batches are then
+// accounted when they are sent.
+type Provider struct {
+	next    provider.Interface
+	limiter *Limiter
+}
+
+// Wrap returns a provider making its calls through next within the limits of l
+func Wrap(next provider.Interface, l *Limiter) *Provider {
+	return &Provider{
+		next:    next,
+		limiter: l,
+	}
+}
+
+// Start starts the wrapped provider
+func (p *Provider) Start() error {
+	return p.next.Start()
+}
+
+// Stop stops the wrapped provider
+func (p *Provider) Stop() {
+	p.next.Stop()
+}
+
+// CallRaw calls a RPC method once the limits allow it
+func (p *Provider) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	defer p.limiter.acquire(p.limiter.Weight(method))()
+	return p.next.CallRaw(method, params...)
+}
+
+// Call calls a RPC method once the limits allow it
+func (p *Provider) Call(result interface{}, method string, params ...interface{}) error {
+	defer p.limiter.acquire(p.limiter.Weight(method))()
+	return p.next.Call(result, method, params...)
+}
+
+// CallBatch sends the batch once the limits allow it, it takes one in flight slot and
+// is charged the weight of every call
+func (p *Provider) CallBatch(batch []*provider.BatchElem) error {
+	n := 0
+	for _, elem := range batch {
+		n += p.limiter.Weight(elem.Method)
+	}
+	defer p.limiter.acquire(n)()
+	return provider.CallBatch(p.next, batch)
+}
+
+// Subscribe creates a subscription once the limits allow it, notifications are not limited
+func (p *Provider) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	defer p.limiter.acquire(p.limiter.Weight(method))()
+	return p.next.Subscribe(receiver, method, event, params...)
+}
+
+// SubscribeErr waits for the weight of the subscription method, see provider.ErrSubscriber
+func (p *Provider) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	defer p.limiter.acquire(p.limiter.Weight(method))()
+	return provider.SubscribeErr(p.next, receiver, errs, method, event, params...)
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/jsonrpc2"
+)
+
+func TestLimiter_Acquire(t *testing.T) {
+	l, err := New(1000, 10, 0)
+	assert.NoError(t, err)
+	l.SetWeight("trace_block", 5)
+
+	// 10 come from the burst, 20 more at 1000 per second
+	start := time.Now()
+	release := l.Acquire([]*jsonrpc2.JSONRPCRequest{
+		{Method: "trace_block"}, {Method: "trace_block"},
+		{Method: "eth_getBlockByNumber"}, {Method: "eth_getBlockByNumber"},
+		{Method: "trace_block"}, {Method: "trace_block"}, {Method: "eth_getBlockByNumber"},
+		{Method: "eth_getBlockByNumber"}, {Method: "eth_getBlockByNumber"}, {Method: "eth_getBlockByNumber"},
+	})
+	release()
+	assert.True(t, time.Since(start) >= 15*time.Millisecond)
+
+	_, err = New(10, 0, 0)
+	assert.Error(t, err)
+}
+
+func TestProvider_MaxInFlight(t *testing.T) {
+	var current, max int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+
+		var req struct{ ID string }
+		json.NewDecoder(r.Body).Decode(&req)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"%s","result":"0x1"}`, req.ID)
+	}))
+	defer srv.Close()
+
+	h, err := httprpc.New(srv.URL)
+	assert.NoError(t, err)
+	l, err := New(0, 0, 2)
+	assert.NoError(t, err)
+	p := Wrap(h, l)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var result string
+			assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&max))
+}
+
+func TestThrottle_Batch(t *testing.T) {
+	var batches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&batches, 1)
+		var reqs []struct{ ID string }
+		json.NewDecoder(r.Body).Decode(&reqs)
+		fmt.Fprint(w, "[")
+		for i, req := range reqs {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"%s","result":"0x1"}`, req.ID)
+		}
+		fmt.Fprint(w, "]")
+	}))
+	defer srv.Close()
+
+	// a wide window, both batches are closed by their size
+	loader, err := httprpc.NewBatchLoader(100, 50*time.Millisecond)
+	assert.NoError(t, err)
+	h, err := httprpc.NewWithLoader(srv.URL, loader)
+	assert.NoError(t, err)
+
+	// the first batch takes the whole burst, the second one waits for 100 new tokens
+	l, err := New(1000, 100, 0)
+	assert.NoError(t, err)
+	h.SetThrottle(l)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// distinct requests, identical ones would be sent once
+			var result string
+			assert.NoError(t, h.Call(&result, "eth_getBalance", fmt.Sprintf("0x%x", i), "latest"))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&batches))
+	assert.True(t, time.Since(start) >= 80*time.Millisecond)
+}
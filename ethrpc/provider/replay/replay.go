@@ -0,0 +1,507 @@
+// Package replay records the calls made to a node into a directory and serves them
+// back offline. The directory follows the testdata/web3_cache layout:
+// <dir>/<method>/<12 digit block number>.json holding one response, or an array of
+// responses when several calls belong to the same block.
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/jsonrpc2"
+)
+
+// Mode tells whether the provider talks to a node or only to the directory
+type Mode int
+
+const (
+	// Record proxies the calls to a node and writes every response
+	Record Mode = iota
+	// Replay serves the recorded responses and fails on anything else
+	Replay
+)
+
+// hashParam is the position of the block hash parameter of the methods taking one
+var hashParam = map[string]int{
+	"eth_getBlockByHash":                    0,
+	"eth_getBlockTransactionCountByHash":    0,
+	"eth_getUncleByBlockHashAndIndex":       0,
+	"eth_getUncleCountByBlockHash":          0,
+	"eth_getTransactionByBlockHashAndIndex": 0,
+}
+
+// indexParam is the position of the index parameter, used to pick a response out
+// of hand written files which hold every uncle or transaction of a block
+var indexParam = map[string]int{
+	"eth_getUncleByBlockHashAndIndex":         1,
+	"eth_getUncleByBlockNumberAndIndex":       1,
+	"eth_getTransactionByBlockHashAndIndex":   1,
+	"eth_getTransactionByBlockNumberAndIndex": 1,
+}
+
+// request is stored next to every recorded response so it can be matched exactly
+type request struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+type entry struct {
+	key      string
+	response json.RawMessage
+}
+
+// Provider records or replays json rpc calls
+type Provider struct {
+	mode Mode
+	dir  string
+	next provider.Interface
+
+	mu sync.Mutex
+	// recorded responses by request
+	byKey map[string]json.RawMessage
+	// every response by method and block, -1 when the file is not named after a block
+	byBlock map[string]map[int64][]*entry
+	// hand written responses by method and by the hash of their result
+	byHash map[string]map[string]json.RawMessage
+	// block numbers by block hash, learned from the results
+	hashes map[string]int64
+	// stored entries of every file, as written on disk
+	files map[string][]json.RawMessage
+}
+
+// New creates a provider over dir. In Record mode the calls go to next, which may
+// be nil in Replay mode. Existing recordings are loaded in both modes.
+func New(mode Mode, dir string, next provider.Interface) (*Provider, error) {
+	if mode == Record && next == nil {
+		return nil, fmt.Errorf("Recording needs a provider")
+	}
+
+	p := &Provider{
+		mode:    mode,
+		dir:     dir,
+		next:    next,
+		byKey:   make(map[string]json.RawMessage),
+		byBlock: make(map[string]map[int64][]*entry),
+		byHash:  make(map[string]map[string]json.RawMessage),
+		hashes:  make(map[string]int64),
+		files:   make(map[string][]json.RawMessage),
+	}
+
+	if err := p.load(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewRecorder records into dir the calls made to next
+func NewRecorder(dir string, next provider.Interface) (*Provider, error) {
+	return New(Record, dir, next)
+}
+
+// NewReplayer serves the calls recorded in dir
+func NewReplayer(dir string) (*Provider, error) {
+	return New(Replay, dir, nil)
+}
+
+// Start starts the node provider when recording
+func (p *Provider) Start() error {
+	if p.mode == Record {
+		return p.next.Start()
+	}
+	return nil
+}
+
+// Stop stops the node provider when recording
+func (p *Provider) Stop() {
+	if p.mode == Record {
+		p.next.Stop()
+	}
+}
+
+// CallRaw calls a RPC method on the node and records the response, or returns the recorded one
+func (p *Provider) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	if p.mode == Replay {
+		return p.lookup(method, params)
+	}
+
+	raw, err := p.next.CallRaw(method, params...)
+	if err != nil {
+		return raw, err
+	}
+	if err := p.record(method, params, raw); err != nil {
+		return raw, fmt.Errorf("replay: recording %s: %s", method, err)
+	}
+	return raw, nil
+}
+
+// Call calls a RPC method on the node and records the response, or decodes the recorded one
+func (p *Provider) Call(result interface{}, method string, params ...interface{}) error {
+	raw, err := p.CallRaw(method, params...)
+	if err != nil {
+		return err
+	}
+
+	return provider.Decode(raw, result)
+}
+
+// CallBatch sends the batch to the node and records the responses, or answers every call
+// from the recordings
+func (p *Provider) CallBatch(batch []*provider.BatchElem) error {
+	if p.mode == Replay {
+		for _, elem := range batch {
+			elem.Raw, elem.Error = p.lookup(elem.Method, elem.Params)
+			if elem.Error == nil {
+				elem.Error = provider.Decode(elem.Raw, elem.Result)
+			}
+		}
+		return nil
+	}
+
+	if err := provider.CallBatch(p.next, batch); err != nil {
+		return err
+	}
+	for _, elem := range batch {
+		if elem.Raw == nil {
+			continue
+		}
+		if err := p.record(elem.Method, elem.Params, elem.Raw); err != nil {
+			return fmt.Errorf("replay: recording %s: %s", elem.Method, err)
+		}
+	}
+	return nil
+}
+
+// Subscribe creates a subscription on the node when recording, notifications are not recorded
+func (p *Provider) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	if p.mode == Replay {
+		return fmt.Errorf("replay: subscriptions can not be replayed")
+	}
+	return p.next.Subscribe(receiver, method, event, params...)
+}
+
+// SubscribeErr passes the subscription through when recording, see provider.ErrSubscriber
+func (p *Provider) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	if p.mode == Replay {
+		return fmt.Errorf("replay: subscriptions can not be replayed")
+	}
+	return provider.SubscribeErr(p.next, receiver, errs, method, event, params...)
+}
+
+// lookup finds the response of a call. Recorded calls are matched on method and
+// params; hand written files, which have no request, are matched on the block
+// and on the transaction hash.
+func (p *Provider) lookup(method string, params []interface{}) ([]byte, error) {
+	k, err := jsonrpc2.RequestKey(method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if raw, ok := p.byKey[k]; ok {
+		return raw, nil
+	}
+
+	// receipts, transactions and blocks looked up by their hash
+	if len(params) > 0 {
+		if hash, ok := params[0].(string); ok {
+			if raw, ok := p.byHash[method][hash]; ok {
+				return raw, nil
+			}
+		}
+	}
+
+	if block, ok := p.block(method, params, nil); ok {
+		var entries []*entry
+		for _, e := range p.byBlock[method][block] {
+			if e.key == "" {
+				entries = append(entries, e)
+			}
+		}
+
+		if i, ok := indexParam[method]; ok && i < len(params) {
+			if index, ok := provider.ParseBlockNumber(params[i]); ok && index < int64(len(entries)) {
+				return entries[index].response, nil
+			}
+		} else if len(entries) == 1 {
+			return entries[0].response, nil
+		}
+	}
+
+	return nil, fmt.Errorf("replay: no recording for %s", k)
+}
+
+// block returns the block a call belongs to, from its params or else from its result
+func (p *Provider) block(method string, params []interface{}, result json.RawMessage) (int64, bool) {
+	if i, ok := provider.BlockParams[method]; ok && i < len(params) {
+		return provider.ParseBlockNumber(params[i])
+	}
+	if i, ok := hashParam[method]; ok && i < len(params) {
+		if hash, ok := params[i].(string); ok {
+			if n, ok := p.hashes[hash]; ok {
+				return n, true
+			}
+		}
+	}
+	if result == nil {
+		return 0, false
+	}
+
+	var r struct {
+		BlockNumber *string `json:"blockNumber"`
+		Number      *string `json:"number"`
+	}
+	if json.Unmarshal(result, &r) != nil {
+		// trace_* results are arrays of items from the same block
+		var items []json.RawMessage
+		if json.Unmarshal(result, &items) != nil || len(items) == 0 {
+			return 0, false
+		}
+		json.Unmarshal(items[0], &r)
+	}
+
+	if r.BlockNumber != nil {
+		return provider.ParseBlockNumber(*r.BlockNumber)
+	}
+	if r.Number != nil {
+		return provider.ParseBlockNumber(*r.Number)
+	}
+	return 0, false
+}
+
+// record adds the response of a call to its file
+func (p *Provider) record(method string, params []interface{}, raw []byte) error {
+	k, err := jsonrpc2.RequestKey(method, params)
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return err
+	}
+	req, err := json.Marshal(request{Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	fields["request"] = req
+	stored, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var name string
+	block, ok := p.block(method, params, fields["result"])
+	if ok {
+		name = fmt.Sprintf("%012d.json", block)
+	} else {
+		block = -1
+		sum := sha256.Sum256([]byte(k))
+		name = hex.EncodeToString(sum[:8]) + ".json"
+	}
+	path := filepath.Join(p.dir, method, name)
+
+	// a call recorded again replaces the previous response
+	entries := p.files[path]
+	replaced := false
+	for i, e := range entries {
+		if storedKey(e) == k {
+			entries[i] = stored
+			replaced = true
+		}
+	}
+	if !replaced {
+		entries = append(entries, stored)
+	}
+
+	if err := write(path, entries); err != nil {
+		return err
+	}
+	p.files[path] = entries
+	p.add(method, block, k, raw, fields["result"])
+	return nil
+}
+
+// add indexes a response
+func (p *Provider) add(method string, block int64, k string, response, result json.RawMessage) {
+	if k != "" {
+		p.byKey[k] = response
+	}
+	if p.byBlock[method] == nil {
+		p.byBlock[method] = make(map[int64][]*entry)
+	}
+	p.byBlock[method][block] = append(p.byBlock[method][block], &entry{k, response})
+	if k == "" {
+		if hash := resultHash(result); hash != "" {
+			if p.byHash[method] == nil {
+				p.byHash[method] = make(map[string]json.RawMessage)
+			}
+			p.byHash[method][hash] = response
+		}
+	}
+
+	var r struct {
+		Hash        *string `json:"hash"`
+		Number      *string `json:"number"`
+		BlockHash   *string `json:"blockHash"`
+		BlockNumber *string `json:"blockNumber"`
+	}
+	if json.Unmarshal(result, &r) != nil {
+		return
+	}
+	if r.Hash != nil && r.Number != nil {
+		if n, ok := provider.ParseBlockNumber(*r.Number); ok {
+			p.hashes[*r.Hash] = n
+		}
+	}
+	if r.BlockHash != nil && r.BlockNumber != nil {
+		if n, ok := provider.ParseBlockNumber(*r.BlockNumber); ok {
+			p.hashes[*r.BlockHash] = n
+		}
+	}
+}
+
+// load reads every file of the directory
+func (p *Provider) load() error {
+	methods, err := ioutil.ReadDir(p.dir)
+	if os.IsNotExist(err) && p.mode == Record {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, m := range methods {
+		if !m.IsDir() {
+			continue
+		}
+		method := m.Name()
+
+		files, err := ioutil.ReadDir(filepath.Join(p.dir, method))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+				continue
+			}
+			if err := p.loadFile(method, filepath.Join(p.dir, method, f.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Provider) loadFile(method, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var entries []json.RawMessage
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &entries)
+	} else {
+		entries = []json.RawMessage{data}
+	}
+	if err != nil {
+		return fmt.Errorf("replay: %s: %s", path, err)
+	}
+
+	block, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(path), ".json"), 10, 64)
+	if err != nil {
+		block = -1
+	}
+
+	for _, stored := range entries {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(stored, &fields); err != nil {
+			return fmt.Errorf("replay: %s: %s", path, err)
+		}
+
+		k := storedKey(stored)
+		response := stored
+		numericID := len(fields["id"]) > 0 && fields["id"][0] != '"'
+		if k != "" || numericID {
+			delete(fields, "request")
+			// hand written files have numeric ids, jsonrpc2 only decodes string ones
+			if numericID {
+				fields["id"], _ = json.Marshal(string(fields["id"]))
+			}
+			if response, err = json.Marshal(fields); err != nil {
+				return err
+			}
+		}
+		p.add(method, block, k, response, fields["result"])
+	}
+
+	p.files[path] = entries
+	return nil
+}
+
+// storedKey returns the key of the request stored with a response, if any
+func storedKey(stored json.RawMessage) string {
+	var s struct {
+		Request *request `json:"request"`
+	}
+	if json.Unmarshal(stored, &s) != nil || s.Request == nil {
+		return ""
+	}
+	k, _ := jsonrpc2.RequestKey(s.Request.Method, s.Request.Params)
+	return k
+}
+
+// write writes the entries of a file, a single one is not wrapped in an array
+func write(path string, entries []json.RawMessage) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	var data []byte
+	var err error
+	if len(entries) == 1 {
+		data, err = json.Marshal(entries[0])
+	} else {
+		data, err = json.Marshal(entries)
+	}
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	return ioutil.WriteFile(path, out.Bytes(), 0644)
+}
+
+// resultHash returns the hash a result is looked up by: the transaction hash of
+// receipts, the own hash of transactions and blocks
+func resultHash(result json.RawMessage) string {
+	var r struct {
+		TransactionHash string `json:"transactionHash"`
+		Hash            string `json:"hash"`
+	}
+	json.Unmarshal(result, &r)
+	if r.TransactionHash != "" {
+		return r.TransactionHash
+	}
+	return r.Hash
+}
@@ -0,0 +1,121 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc"
+)
+
+// node answers every call with its first param and the block it belongs to
+type node struct {
+	calls int
+	errs  chan error
+}
+
+func (n *node) Start() error { return nil }
+func (n *node) Stop()        {}
+func (n *node) Call(result interface{}, method string, params ...interface{}) error {
+	return fmt.Errorf("not implemented")
+}
+func (n *node) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	n.calls++
+	if method == "eth_getCode" {
+		return []byte(`{"jsonrpc":"2.0","id":"1","error":{"code":-32000,"message":"missing trie node"}}`), nil
+	}
+	return []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":"1","result":{"blockNumber":"0x10","value":%q}}`, params[0])), nil
+}
+func (n *node) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	return nil
+}
+func (n *node) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	n.errs = errs
+	return nil
+}
+
+func TestProvider_ReplayCache(t *testing.T) {
+	p, err := NewReplayer("../../../testdata/web3_cache")
+	assert.NoError(t, err)
+	eth, err := ethrpc.New(p)
+	assert.NoError(t, err)
+
+	block, err := eth.GetBlockByNumber("0x6acffe")
+	assert.NoError(t, err)
+	assert.Equal(t, "0x9373c5a56cef18103257a31c70596ad1517ac5766a4dc666d2b3146c6d08339b", block.Hash)
+
+	receipt, err := eth.GetTransactionReceipt("0x9a46688e228eb05fbfac5c73ad1db4feb175b559252585573d777163e95e1b85")
+	assert.NoError(t, err)
+	assert.Equal(t, "0x9a46688e228eb05fbfac5c73ad1db4feb175b559252585573d777163e95e1b85", receipt.TransactionHash)
+
+	uncle, err := eth.GetUncleByBlockHashAndIndex(block.Hash, "0x1")
+	assert.NoError(t, err)
+	assert.Equal(t, block.Uncles[1], uncle.Hash)
+
+	traces, err := eth.TraceBlock("0x6acffe")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, traces)
+
+	_, err = eth.GetBlockByNumber("0x6acfff")
+	assert.Error(t, err)
+}
+
+func TestProvider_RecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := &node{}
+	recorder, err := NewRecorder(dir, n)
+	assert.NoError(t, err)
+
+	var result struct{ Value string }
+	assert.NoError(t, recorder.Call(&result, "eth_getTransactionReceipt", "0xa"))
+	assert.NoError(t, recorder.Call(&result, "eth_getTransactionReceipt", "0xb"))
+	assert.NoError(t, recorder.Call(&result, "eth_getBlockByNumber", "0x10", true))
+	assert.IsType(t, &etherr.RpcError{}, recorder.Call(&result, "eth_getCode", "0x0", "latest"))
+	assert.Equal(t, 4, n.calls)
+
+	// both receipts are in the file of their block
+	var receipts []json.RawMessage
+	data, err := ioutil.ReadFile(filepath.Join(dir, "eth_getTransactionReceipt", "000000000016.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &receipts))
+	assert.Len(t, receipts, 2)
+
+	replayer, err := NewReplayer(dir)
+	assert.NoError(t, err)
+
+	assert.NoError(t, replayer.Call(&result, "eth_getTransactionReceipt", "0xb"))
+	assert.Equal(t, "0xb", result.Value)
+	assert.NoError(t, replayer.Call(&result, "eth_getBlockByNumber", "0x10", true))
+	assert.Equal(t, "0x10", result.Value)
+	assert.IsType(t, &etherr.RpcError{}, replayer.Call(&result, "eth_getCode", "0x0", "latest"))
+
+	err = replayer.Call(&result, "eth_getBlockByNumber", "0x10", false)
+	assert.EqualError(t, err, `replay: no recording for eth_getBlockByNumber ["0x10",false]`)
+	assert.Equal(t, 4, n.calls)
+}
+
+func TestProvider_SubscribeErr(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := &node{}
+	recorder, err := NewRecorder(dir, n)
+	assert.NoError(t, err)
+	errs := make(chan error, 1)
+	assert.NoError(t, recorder.SubscribeErr(make(chan *json.RawMessage), errs, "eth_subscribe", "newHeads"))
+	assert.Equal(t, errs, n.errs)
+
+	replayer, err := NewReplayer(dir)
+	assert.NoError(t, err)
+	assert.Error(t, replayer.SubscribeErr(make(chan *json.RawMessage), errs, "eth_subscribe", "newHeads"))
+}
@@ -0,0 +1,262 @@
+// Package retry wraps a provider retrying the calls which failed for transient reasons
+package retry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/jsonrpc2"
+)
+
+const (
+	// DefaultAttempts is the default number of times a call is tried
+	DefaultAttempts = 5
+
+	// DefaultMinBackoff is the default wait after the first failure
+	DefaultMinBackoff = 100 * time.Millisecond
+
+	// DefaultMaxBackoff is the default upper bound of the wait between attempts
+	DefaultMaxBackoff = 10 * time.Second
+
+	// LimitExceededCode is the json rpc error code used by nodes and hosted providers
+	// when the request rate is too high
+	LimitExceededCode = -32005
+)
+
+// Provider retries the calls of the wrapped provider with exponential backoff
+type Provider struct {
+	next       provider.Interface
+	attempts   int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// New wraps a provider so failed calls are tried up to attempts times in total
+func New(next provider.Interface, attempts int, minBackoff, maxBackoff time.Duration) (*Provider, error) {
+	if attempts < 1 {
+		return nil, fmt.Errorf("At least one attempt is needed")
+	}
+	if minBackoff <= 0 || maxBackoff < minBackoff {
+		return nil, fmt.Errorf("Backoff must be positive and the maximum not less than the minimum")
+	}
+
+	return &Provider{
+		next:       next,
+		attempts:   attempts,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+	}, nil
+}
+
+// NewWithDefaults wraps a provider using the default attempts and backoff
+func NewWithDefaults(next provider.Interface) *Provider {
+	p, _ := New(next, DefaultAttempts, DefaultMinBackoff, DefaultMaxBackoff)
+	return p
+}
+
+// Start starts the wrapped provider
+func (p *Provider) Start() error {
+	return p.next.Start()
+}
+
+// Stop stops the wrapped provider
+func (p *Provider) Stop() {
+	p.next.Stop()
+}
+
+// Call calls a RPC method retrying on transient errors
+func (p *Provider) Call(result interface{}, method string, params ...interface{}) error {
+	var err error
+	for attempt := 0; attempt < p.attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(p.backoff(attempt, err))
+		}
+
+		err = p.next.Call(result, method, params...)
+		if !IsRetryableCall(method, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// CallRaw calls a RPC method retrying on transient errors. Rate limit errors
+// inside the raw response are retried as well.
+func (p *Provider) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	var raw []byte
+	var err error
+	for attempt := 0; attempt < p.attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(p.backoff(attempt, err))
+		}
+
+		raw, err = p.next.CallRaw(method, params...)
+		if err != nil {
+			if !IsRetryableCall(method, err) {
+				return raw, err
+			}
+			continue
+		}
+
+		rpcErr := responseError(raw)
+		if !IsRetryable(rpcErr) {
+			return raw, nil
+		}
+		// remembered for the backoff, the raw response is what the caller gets if we give up
+		err = rpcErr
+	}
+
+	if _, ok := err.(*etherr.RpcError); ok {
+		return raw, nil
+	}
+	return raw, err
+}
+
+// CallBatch sends the batch through the wrapped provider, retrying it as a whole on
+// transient errors when every call of it can be retried
+func (p *Provider) CallBatch(batch []*provider.BatchElem) error {
+	var err error
+	for attempt := 0; attempt < p.attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(p.backoff(attempt, err))
+		}
+
+		err = provider.CallBatch(p.next, batch)
+		if err == nil {
+			return nil
+		}
+		for _, elem := range batch {
+			if !IsRetryableCall(elem.Method, err) {
+				return err
+			}
+		}
+	}
+	return err
+}
+
+// Subscribe creates a subscription on the wrapped provider, subscriptions are not retried
+func (p *Provider) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
+	return p.next.Subscribe(receiver, method, event, params...)
+}
+
+// SubscribeErr passes the subscription through, see provider.ErrSubscriber
+func (p *Provider) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	return provider.SubscribeErr(p.next, receiver, errs, method, event, params...)
+}
+
+// backoff returns how long to wait before the given attempt: exponential with
+// jitter, unless the server asked for a specific delay. Both are capped by maxBackoff.
+func (p *Provider) backoff(attempt int, err error) time.Duration {
+	if httpErr, ok := err.(*etherr.HTTPError); ok && httpErr.RetryAfter > 0 {
+		if httpErr.RetryAfter > p.maxBackoff {
+			return p.maxBackoff
+		}
+		return httpErr.RetryAfter
+	}
+
+	d := p.minBackoff
+	for i := 1; i < attempt && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+
+	// wait at least half of it so the backoff keeps growing
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// responseError returns the json rpc error held by a raw response
+func responseError(raw []byte) error {
+	resp, err := jsonrpc2.DecodeResponse(raw)
+	if err != nil || resp.Error == nil {
+		return nil
+	}
+	return etherr.New(resp.Error.Message, resp.Error.Code, resp.Error.Data)
+}
+
+// IsRetryableCall tells if a call of method which failed with err may be made again.
+// Transactions are only sent again when the first attempt surely did not reach the node.
+func IsRetryableCall(method string, err error) bool {
+	if !IsRetryable(err) {
+		return false
+	}
+	return provider.IsIdempotent(method) || unsent(err)
+}
+
+// unsent returns true for errors which guarantee the request did not reach the node:
+// the connection could not be made or the request was turned down by a rate limit
+func unsent(err error) bool {
+	if e, ok := err.(*url.Error); ok {
+		err = e.Err
+	}
+
+	switch e := err.(type) {
+	case *etherr.HTTPError:
+		return e.StatusCode == 429
+	case *etherr.RpcError:
+		return e.Code == LimitExceededCode
+	case *net.OpError:
+		return e.Op == "dial"
+	}
+	return false
+}
+
+// IsRetryable returns true for errors which are likely to go away when the
+// call is made again: transient transport errors, calls the node did not answer in
+// time, overloaded or rate limiting servers. Execution errors, reverts, bad urls and
+// certificates are permanent.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == etherr.VMExecutionError {
+		return false
+	}
+	if err == etherr.ConnectionClosed || err == etherr.RequestTimeout || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	switch e := err.(type) {
+	case *etherr.HTTPError:
+		switch e.StatusCode {
+		case 429, 502, 503, 504:
+			return true
+		}
+		return false
+	case *etherr.RpcError:
+		return e.Code == LimitExceededCode
+	case *url.Error:
+		return transient(e.Err)
+	}
+
+	return transient(err)
+}
+
+// transient tells if a transport error is likely to go away: the connection was refused,
+// reset or timed out. TLS failures and malformed requests are not.
+func transient(err error) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	switch e := err.(type) {
+	case *net.OpError:
+		if dnsErr, ok := e.Err.(*net.DNSError); ok {
+			return dnsErr.IsTimeout || dnsErr.IsTemporary
+		}
+		// tls alerts are reported as "remote error" or "local error"
+		return e.Op == "dial" || e.Op == "read" || e.Op == "write"
+	case net.Error:
+		return e.Timeout()
+	}
+	return false
+}
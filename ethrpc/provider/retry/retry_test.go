@@ -0,0 +1,184 @@
+package retry
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/ethrpc/provider/wsrpc"
+	"github.com/alethio/web3-go/rpctest"
+)
+
+// server answers with the given status codes first and with a block number afterwards
+func server(statuses ...int) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			fmt.Fprint(w, "<html>busy</html>")
+			return
+		}
+
+		var req struct{ ID string }
+		json.NewDecoder(r.Body).Decode(&req)
+		fmt.Fprintf(w, `{"jsonrpc":"2.0","id":"%s","result":"0x10"}`, req.ID)
+	}))
+	return srv, &calls
+}
+
+func TestProvider_Call(t *testing.T) {
+	var tests = map[string]struct {
+		statuses []int
+		calls    int32
+		err      bool
+	}{
+		"success":      {nil, 1, false},
+		"rate limited": {[]int{429, 503}, 3, false},
+		"permanent":    {[]int{400}, 1, true},
+		"exhausted":    {[]int{502, 502, 502}, 3, true},
+	}
+
+	for n, tt := range tests {
+		t.Run(n, func(t *testing.T) {
+			srv, calls := server(tt.statuses...)
+			defer srv.Close()
+
+			h, err := httprpc.New(srv.URL)
+			assert.NoError(t, err)
+			p, err := New(h, 3, time.Millisecond, 5*time.Millisecond)
+			assert.NoError(t, err)
+
+			var result string
+			err = p.Call(&result, "eth_blockNumber")
+			if tt.err {
+				assert.IsType(t, &etherr.HTTPError{}, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "0x10", result)
+			}
+			assert.Equal(t, tt.calls, atomic.LoadInt32(calls))
+		})
+	}
+}
+
+func TestProvider_RetryAfter(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(429)
+			return
+		}
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":"1","result":"0x10"}`)
+	}))
+	defer srv.Close()
+
+	h, err := httprpc.New(srv.URL)
+	assert.NoError(t, err)
+	p, err := New(h, 3, time.Millisecond, 5*time.Millisecond)
+	assert.NoError(t, err)
+
+	// the delay asked by the server is capped by the maximum backoff
+	start := time.Now()
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestProvider_NonIdempotent(t *testing.T) {
+	// the node gets the request, the response is lost
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer srv.Close()
+
+	h, err := httprpc.New(srv.URL)
+	assert.NoError(t, err)
+	p, err := New(h, 3, time.Millisecond, 5*time.Millisecond)
+	assert.NoError(t, err)
+
+	var result string
+	assert.Error(t, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	assert.Error(t, p.Call(&result, "eth_sendRawTransaction", "0x00"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.False(t, IsRetryable(nil))
+	assert.False(t, IsRetryable(etherr.VMExecutionError))
+	assert.False(t, IsRetryable(etherr.New("execution reverted", 3, "0x")))
+	assert.True(t, IsRetryable(etherr.New("limit exceeded", LimitExceededCode, "")))
+	assert.True(t, IsRetryable(etherr.ConnectionClosed))
+	assert.True(t, IsRetryable(etherr.RequestTimeout))
+	assert.True(t, IsRetryable(&etherr.HTTPError{StatusCode: 429}))
+	assert.False(t, IsRetryable(&etherr.HTTPError{StatusCode: 500}))
+
+	refused := &url.Error{Op: "Post", URL: "http://localhost:1", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	assert.True(t, IsRetryable(refused))
+	assert.False(t, IsRetryable(&url.Error{Op: "Post", URL: "ftp://localhost", Err: errors.New("unsupported protocol scheme")}))
+	assert.False(t, IsRetryable(&url.Error{Op: "Post", URL: "https://localhost", Err: x509.UnknownAuthorityError{}}))
+
+	// a transaction is only sent again when the first one surely did not reach the node
+	assert.True(t, IsRetryableCall("eth_sendRawTransaction", refused))
+	assert.True(t, IsRetryableCall("eth_sendRawTransaction", &etherr.HTTPError{StatusCode: 429}))
+	assert.False(t, IsRetryableCall("eth_sendRawTransaction", &etherr.HTTPError{StatusCode: 503}))
+	assert.False(t, IsRetryableCall("eth_sendRawTransaction", etherr.ConnectionClosed))
+	assert.True(t, IsRetryableCall("eth_getBalance", etherr.ConnectionClosed))
+	assert.False(t, IsRetryableCall("eth_sendRawTransaction", etherr.RequestTimeout))
+}
+
+func TestProvider_Timeout(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+	srv.Handle("eth_sendRawTransaction", "0xdead")
+	srv.SetLatency(100 * time.Millisecond)
+
+	ws, err := wsrpc.New(srv.WSURL, false, wsrpc.WithCallTimeout(30*time.Millisecond))
+	assert.NoError(t, err)
+	p, err := New(ws, 3, time.Millisecond, time.Millisecond)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	// the server counts the requests once it answers them
+	count := func(method string, n int) int {
+		deadline := time.Now().Add(2 * time.Second)
+		for srv.Count(method) < n && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		return srv.Count(method)
+	}
+
+	// the node did not answer in time, a read is asked again
+	var result string
+	assert.Equal(t, etherr.RequestTimeout, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, 3, count("eth_blockNumber", 3))
+
+	// the transaction may have reached it
+	assert.Equal(t, etherr.RequestTimeout, p.Call(&result, "eth_sendRawTransaction", "0x00"))
+	assert.Equal(t, 1, count("eth_sendRawTransaction", 1))
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, 1, srv.Count("eth_sendRawTransaction"))
+}
@@ -0,0 +1,46 @@
+package provider
+
+import "strings"
+
+// filters are the methods creating or reading state on the node, every call must reach it
+var filters = map[string]bool{
+	"eth_newFilter":                   true,
+	"eth_newBlockFilter":              true,
+	"eth_newPendingTransactionFilter": true,
+	"eth_getFilterChanges":            true,
+}
+
+// nonIdempotent are the methods sending or signing transactions: every call has its own
+// effect, a second transaction fails with "already known" or "nonce too low" even though
+// the first one went through
+var nonIdempotent = map[string]bool{
+	"eth_sendTransaction":               true,
+	"eth_sendRawTransaction":            true,
+	"eth_sendRawTransactionConditional": true,
+	"eth_sendBundle":                    true,
+	"eth_sendPrivateTransaction":        true,
+	"eth_sign":                          true,
+	"eth_signTransaction":               true,
+	"eth_signTypedData":                 true,
+	"eth_signTypedData_v3":              true,
+	"eth_signTypedData_v4":              true,
+	"personal_sendTransaction":          true,
+	"personal_signAndSendTransaction":   true,
+	"personal_sign":                     true,
+	"personal_signTransaction":          true,
+}
+
+// IsIdempotent tells if method can be called twice with the effect of a single call,
+// which is the case of everything but sending and signing transactions
+func IsIdempotent(method string) bool {
+	return !nonIdempotent[method]
+}
+
+// Shareable tells if the response to a call of method can be given to identical calls,
+// which is the case of everything but subscriptions, filters, sending and signing
+func Shareable(method string) bool {
+	if strings.HasSuffix(method, "_subscribe") || strings.HasSuffix(method, "_unsubscribe") {
+		return false
+	}
+	return !filters[method] && IsIdempotent(method)
+}
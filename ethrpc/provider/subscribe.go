@@ -0,0 +1,31 @@
+package provider
+
+import "encoding/json"
+
+// ErrSubscriber is implemented by the providers able to tell why a subscription fails
+type ErrSubscriber interface {
+	// SubscribeErr is Subscribe with errs receiving the errors the node sends for the
+	// subscription and, before the receiver is closed, the cause of its end. errs should
+	// be buffered, the errors it has no room for are dropped.
+	SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error
+}
+
+// SubscribeErr subscribes through p.SubscribeErr when p is an ErrSubscriber, with a
+// plain Subscribe otherwise: errs then receives nothing
+func SubscribeErr(p Interface, receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	if s, ok := p.(ErrSubscriber); ok {
+		return s.SubscribeErr(receiver, errs, method, event, params...)
+	}
+	return p.Subscribe(receiver, method, event, params...)
+}
+
+// SendErr hands err to errs unless it is nil or full, the subscription goes on without waiting
+func SendErr(errs chan error, err error) {
+	if errs == nil {
+		return
+	}
+	select {
+	case errs <- err:
+	default:
+	}
+}
@@ -0,0 +1,116 @@
+package wsrpc
+
+import (
+	"time"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/gorilla/websocket"
+)
+
+// reconnectWait is the time between two connection attempts of the auto reconnect
+const reconnectWait = time.Second
+
+func (p *WSProvider) isStopped() bool {
+	p.deadMu.Lock()
+	defer p.deadMu.Unlock()
+	return p.stopped
+}
+
+// connectionEnded ends the subscriptions of the connection of cancel with the cause given
+// to fatality, or cause. With auto reconnect they are handed over to the reconnection instead.
+func (p *WSProvider) connectionEnded(cancel chan struct{}, cause error) {
+	p.mu.Lock()
+	ended := make(map[string]*subscription)
+	for id, sub := range p.subscriptions {
+		if sub.cancel != cancel {
+			continue
+		}
+		if sub.cause == nil {
+			sub.cause = cause
+		}
+		ended[id] = sub
+		delete(p.subscriptions, id)
+	}
+	p.mu.Unlock()
+
+	if p.autoReconnect && !p.isStopped() {
+		go p.reconnect(ended)
+		return
+	}
+	for id, sub := range ended {
+		p.end(id, sub, sub.cause)
+	}
+}
+
+// reconnect connects again until it succeeds or Stop is called, then renews the
+// subscriptions. They receive the cause of the death of the connection as a notice
+// of the gap, those that can not be renewed are ended.
+func (p *WSProvider) reconnect(subscriptions map[string]*subscription) {
+	for {
+		err := p.start()
+		if err == nil {
+			break
+		}
+		if p.isStopped() {
+			for id, sub := range subscriptions {
+				p.end(id, sub, etherr.ConnectionClosed)
+			}
+			return
+		}
+		p.log.Warnf("reconnecting: %s", err)
+		time.Sleep(reconnectWait)
+	}
+
+	for id, sub := range subscriptions {
+		// after the notifications of the previous connection
+		sub.delivery.Err(sub.cause)
+		if err := p.subscribe(sub); err != nil {
+			p.log.Warnf("renewing subscription to %s: %s", sub.event, err)
+			p.end(id, sub, err)
+		}
+	}
+}
+
+// watchdog kills the connection of cancel when a subscription to an event with a stall
+// timeout got no notification for that long, like newHeads from a node that stopped
+// following the chain while still answering the pings
+func (p *WSProvider) watchdog(c *websocket.Conn, cancel chan struct{}) {
+	interval := time.Duration(0)
+	for _, timeout := range p.stallTimeouts {
+		if interval == 0 || timeout/4 < interval {
+			interval = timeout / 4
+		}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if event, stalled := p.stalled(cancel); stalled {
+				p.log.Warnf("no %s notification for %s, the connection stalled", event, p.stallTimeouts[event])
+				p.mu.Lock()
+				p.stalls++
+				p.mu.Unlock()
+				p.fatality(c, etherr.SubscriptionStalled)
+				return
+			}
+		case <-cancel:
+			return
+		}
+	}
+}
+
+// stalled tells if a subscription of the connection of cancel waits for too long
+func (p *WSProvider) stalled(cancel chan struct{}) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, sub := range p.subscriptions {
+		timeout, ok := p.stallTimeouts[sub.event]
+		if ok && sub.cancel == cancel && time.Since(sub.last) > timeout {
+			return sub.event, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,181 @@
+package wsrpc
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/alethio/web3-go/logger"
+)
+
+// Option configures a WSProvider when it is created
+type Option func(p *WSProvider) error
+
+// WithWriteTimeout sets the time allowed to write a message, DefaultWriteTimeout otherwise
+func WithWriteTimeout(d time.Duration) Option {
+	return func(p *WSProvider) error {
+		if d <= 0 {
+			return fmt.Errorf("Write timeout must be positive")
+		}
+		p.writeWait = d
+		return nil
+	}
+}
+
+// WithPingInterval sets the period of the pings keeping the connection alive, DefaultPingInterval otherwise
+func WithPingInterval(d time.Duration) Option {
+	return func(p *WSProvider) error {
+		if d <= 0 {
+			return fmt.Errorf("Ping interval must be positive")
+		}
+		p.pingPeriod = d
+		return nil
+	}
+}
+
+// WithPongTimeout sets the time allowed to read the next message, the pongs included, before
+// the connection is considered dead, DefaultPongTimeout otherwise. It must exceed the ping interval.
+func WithPongTimeout(d time.Duration) Option {
+	return func(p *WSProvider) error {
+		if d <= 0 {
+			return fmt.Errorf("Pong timeout must be positive")
+		}
+		p.pongWait = d
+		return nil
+	}
+}
+
+// WithStallTimeout kills the connection when a subscription to event gets no notification
+// for d, like newHeads from a node that stopped following the chain
+func WithStallTimeout(event string, d time.Duration) Option {
+	return func(p *WSProvider) error {
+		if d <= 0 {
+			return fmt.Errorf("Stall timeout must be positive")
+		}
+		if p.stallTimeouts == nil {
+			p.stallTimeouts = make(map[string]time.Duration)
+		}
+		p.stallTimeouts[event] = d
+		return nil
+	}
+}
+
+// WithAutoReconnect replaces a connection that died, other than by Stop, and renews its
+// subscriptions. They get the cause on their error channel but are not closed, unless
+// renewing them fails.
+func WithAutoReconnect() Option {
+	return func(p *WSProvider) error {
+		p.autoReconnect = true
+		return nil
+	}
+}
+
+// WithHandshakeTimeout sets the time allowed to open a connection
+func WithHandshakeTimeout(d time.Duration) Option {
+	return func(p *WSProvider) error {
+		p.dialer.HandshakeTimeout = d
+		return nil
+	}
+}
+
+// WithTLSConfig sets the tls configuration of wss connections
+func WithTLSConfig(config *tls.Config) Option {
+	return func(p *WSProvider) error {
+		p.dialer.TLSClientConfig = config
+		return nil
+	}
+}
+
+// WithProxy sets the function picking the proxy of the connections, like http.ProxyFromEnvironment
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(p *WSProvider) error {
+		p.dialer.Proxy = proxy
+		return nil
+	}
+}
+
+// WithBufferSizes sets the sizes of the read and write buffers of the connections
+func WithBufferSizes(read, write int) Option {
+	return func(p *WSProvider) error {
+		if read < 0 || write < 0 {
+			return fmt.Errorf("Buffer sizes can not be negative")
+		}
+		p.dialer.ReadBufferSize = read
+		p.dialer.WriteBufferSize = write
+		return nil
+	}
+}
+
+// WithHeader sets a header sent with the handshake of every connection, see SetHeader
+func WithHeader(key, value string) Option {
+	return func(p *WSProvider) error {
+		p.SetHeader(key, value)
+		return nil
+	}
+}
+
+// WithHeaderFunc sets a function called for the headers of every connection, see SetHeaderFunc
+func WithHeaderFunc(f func() (http.Header, error)) Option {
+	return func(p *WSProvider) error {
+		p.headerFunc = f
+		return nil
+	}
+}
+
+// WithSingleflight shares the response of a call with the identical calls made while it is in flight
+func WithSingleflight() Option {
+	return func(p *WSProvider) error {
+		p.flights = &singleflight.Group{}
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the connection events, logger.Default otherwise
+func WithLogger(l logger.Logger) Option {
+	return func(p *WSProvider) error {
+		if l == nil {
+			return fmt.Errorf("Logger can not be nil, use logger.Nop to discard the logs")
+		}
+		p.log = l
+		return nil
+	}
+}
+
+// WithOverflowPolicy sets what happens to the notifications of a subscription whose receiver is full, Block otherwise
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(p *WSProvider) error {
+		if policy < Block || policy > Terminate {
+			return fmt.Errorf("Unknown overflow policy %d", policy)
+		}
+		p.overflow = policy
+		return nil
+	}
+}
+
+// WithMaxQueued sets the number of notifications a subscription queues while its receiver
+// is full, provider.DefaultMaxQueued otherwise. The subscription is terminated past it.
+func WithMaxQueued(n int) Option {
+	return func(p *WSProvider) error {
+		if n <= 0 {
+			return fmt.Errorf("Queue size must be positive")
+		}
+		p.maxQueued = n
+		return nil
+	}
+}
+
+// WithCallTimeout sets the time a call waits for its response, DefaultCallTimeout otherwise.
+// The response of a call that timed out is dropped when it comes.
+func WithCallTimeout(d time.Duration) Option {
+	return func(p *WSProvider) error {
+		if d <= 0 {
+			return fmt.Errorf("Call timeout must be positive")
+		}
+		p.callTimeout = d
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package wsrpc
+
+import "encoding/json"
+
+// OverflowPolicy tells what happens to a notification when the receiver of its
+// subscription is full. Notifications are delivered in order whatever the policy, each
+// subscription from its own queue: the other messages of the connection never wait.
+type OverflowPolicy int
+
+const (
+	// Block waits for the consumer, the notifications of the subscription queue up meanwhile.
+	// The subscription is terminated once its queue is full, see WithMaxQueued. The default.
+	Block OverflowPolicy = iota
+	// DropOldest drops the oldest notification waiting in the receiver to make room
+	DropOldest
+	// DropNewest drops the notification that does not fit
+	DropNewest
+	// Terminate ends the subscription with etherr.SubscriptionOverflow
+	Terminate
+)
+
+func (o OverflowPolicy) String() string {
+	switch o {
+	case Block:
+		return "block"
+	case DropOldest:
+		return "drop-oldest"
+	case DropNewest:
+		return "drop-newest"
+	case Terminate:
+		return "terminate"
+	}
+	return "unknown"
+}
+
+// deliver hands n to receiver following the policy, it returns the number of dropped
+// notifications and false when the subscription has to be terminated. Block gives up
+// when the subscription ended.
+func (o OverflowPolicy) deliver(receiver chan *json.RawMessage, n *json.RawMessage, ended chan struct{}) (int, bool) {
+	if o == Block {
+		select {
+		case receiver <- n:
+		case <-ended:
+		}
+		return 0, true
+	}
+
+	dropped := 0
+	for {
+		select {
+		case receiver <- n:
+			return dropped, true
+		default:
+		}
+
+		switch {
+		case o == Terminate:
+			return 0, false
+		case o == DropNewest, cap(receiver) == 0:
+			// an unbuffered receiver has no oldest notification to drop
+			return dropped + 1, true
+		}
+
+		// the consumer may have made room meanwhile, only count what was taken
+		select {
+		case <-receiver:
+			dropped++
+		default:
+		}
+	}
+}
@@ -3,30 +3,35 @@ package wsrpc
 import (
 	"encoding/json"
 	"fmt"
-	"math/rand"
+	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"golang.org/x/sync/singleflight"
 	"golang.org/x/time/rate"
 
 	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
 	"github.com/alethio/web3-go/jsonrpc2"
+	"github.com/alethio/web3-go/logger"
 	"github.com/gorilla/websocket"
-	log "github.com/sirupsen/logrus"
 )
 
 const (
-	// Time allowed to write a message to the peer.
-	writeWait = 60 * time.Second
+	// DefaultWriteTimeout is the time allowed to write a message to the peer.
+	DefaultWriteTimeout = 60 * time.Second
 
-	// Time allowed to read the next pong message from the peer.
-	pongWait = 60 * time.Second
+	// DefaultPongTimeout is the time allowed to read the next message from the peer, the
+	// pongs answering the pings included. The connection is dead past it.
+	DefaultPongTimeout = 60 * time.Second
 
-	// Send pings to peer with this period. Must be less than pongWait.
-	pingPeriod = (pongWait * 9) / 10
+	// DefaultPingInterval is the period of the pings sent to the peer. Must be less than the pong timeout.
+	DefaultPingInterval = (DefaultPongTimeout * 9) / 10
+
+	// DefaultCallTimeout is the time a call waits for its response
+	DefaultCallTimeout = 60 * time.Second
 )
 
 type WSProvider struct {
@@ -35,319 +40,603 @@ type WSProvider struct {
 	client        *websocket.Conn
 	mu            sync.Mutex
 	send          chan []byte
-	requests      map[string]chan *jsonrpc2.JSONRPCMessage
-	subscriptions map[string]chan *json.RawMessage
+	pending       *provider.Pending
+	subscriptions map[string]*subscription
 	cancel        chan struct{}
 	dead          bool
 	deadMu        sync.Mutex
+	connections   int
+	flights       *singleflight.Group
+	header        http.Header
+	headerFunc    func() (http.Header, error)
+	dialer        *websocket.Dialer
+	writeWait     time.Duration
+	pingPeriod    time.Duration
+	pongWait      time.Duration
+	log           logger.Logger
+	overflow      OverflowPolicy
+	maxQueued     int
+	callTimeout   time.Duration
+	dropped       int
+	overflows     int
+	stallTimeouts map[string]time.Duration
+	stalls        int
+	autoReconnect bool
+	// stopped is set by Stop, a dead connection is not replaced then
+	stopped bool
+}
+
+// subscription is the receiver of the notifications of a subscription and of its errors
+type subscription struct {
+	receiver chan *json.RawMessage
+	errs     chan error
+	method   string
+	event    string
+	params   []interface{}
+	// cancel is the one of the connection the subscription lives on
+	cancel chan struct{}
+	// cause is the reason of the death of the connection, once known
+	cause error
+	// last is the time of the last notification, or of the subscription
+	last time.Time
+	// id is the one given by the node to the subscription on its current connection
+	id string
+	// delivery hands the notifications to the receiver, it lives as long as the subscription
+	delivery *provider.Delivery
+}
+
+// Stats describes the state of a websocket provider
+type Stats struct {
+	// Reconnects is the number of connections made after the first one
+	Reconnects int
+	// PendingRequests is the number of requests waiting for their response
+	PendingRequests int
+	// Subscriptions is the number of active subscriptions
+	Subscriptions int
+	// SubscriptionBacklog is the number of notifications waiting in the subscription channels
+	SubscriptionBacklog int
+	// DroppedNotifications is the number of notifications dropped by the overflow policy
+	DroppedNotifications int
+	// Overflows is the number of subscriptions terminated by the overflow policy
+	Overflows int
+	// Stalls is the number of connections killed by the stall detector
+	Stalls int
 }
 
-// Start connects to parity and starts listening for notifications
+// Start connects to parity and starts listening for notifications, it does nothing while
+// the connection is alive
 func (p *WSProvider) Start() error {
-	err := p.connect()
+	p.deadMu.Lock()
+	p.stopped = false
+	alive := !p.dead
+	p.deadMu.Unlock()
+	if alive {
+		return nil
+	}
+	return p.start()
+}
+
+// start connects and starts the pumps of the new connection, unless Stop was called meanwhile
+func (p *WSProvider) start() error {
+	c, err := p.connect()
 	if err != nil {
 		return err
 	}
 	p.deadMu.Lock()
+	if p.stopped {
+		p.deadMu.Unlock()
+		c.Close()
+		return etherr.ConnectionClosed
+	}
+	if !p.dead {
+		// another Start connected meanwhile
+		p.deadMu.Unlock()
+		c.Close()
+		return nil
+	}
+	if p.dead {
+		// the previous connection closed the channel when it died
+		select {
+		case <-p.cancel:
+			p.cancel = make(chan struct{})
+			p.send = make(chan []byte)
+		default:
+		}
+	}
 	p.dead = false
+	p.client = c
+	p.connections++
+	send, cancel := p.send, p.cancel
 	p.deadMu.Unlock()
-	go p.receivePump()
-	go p.sendPump()
+
+	// the pumps only touch their own connection, a new one may replace it after it died
+	go p.receivePump(c, cancel)
+	go p.sendPump(c, send, cancel)
+	if len(p.stallTimeouts) > 0 {
+		go p.watchdog(c, cancel)
+	}
 	return nil
 }
 
-// Stop closes the websocket connection
+// Stop closes the websocket connection, it is not replaced even with auto reconnect
 func (p *WSProvider) Stop() {
-	p.fatality()
+	p.deadMu.Lock()
+	p.stopped = true
+	c := p.client
+	p.deadMu.Unlock()
+	if c != nil {
+		p.fatality(c, etherr.ConnectionClosed)
+	}
 }
 
-// CallRaw calls a RPC method and returns the raw result
-func (p *WSProvider) CallRaw(method string, params ...interface{}) ([]byte, error) {
-	receiver := make(chan *jsonrpc2.JSONRPCMessage)
-	err := p.makeRequest(receiver, method, params)
-	if err != nil {
-		return nil, fmt.Errorf("call: %s", err)
+// Stats returns the current state of the provider
+func (p *WSProvider) Stats() Stats {
+	var s Stats
+
+	p.deadMu.Lock()
+	if p.connections > 1 {
+		s.Reconnects = p.connections - 1
 	}
+	p.deadMu.Unlock()
 
-	var resp *jsonrpc2.JSONRPCMessage
-	select {
-	case resp = <-receiver:
-		break
-	case <-p.cancel:
-		return nil, etherr.ConnectionClosed
+	p.mu.Lock()
+	s.PendingRequests = p.pending.Len()
+	s.Subscriptions = len(p.subscriptions)
+	for _, sub := range p.subscriptions {
+		s.SubscriptionBacklog += sub.delivery.Len()
 	}
+	s.DroppedNotifications = p.dropped
+	s.Overflows = p.overflows
+	s.Stalls = p.stalls
+	p.mu.Unlock()
 
+	return s
+}
+
+// CallRaw calls a RPC method and returns the raw result
+func (p *WSProvider) CallRaw(method string, params ...interface{}) ([]byte, error) {
+	resp, err := p.call(method, params)
+	if err != nil {
+		return nil, err
+	}
 	return resp.Raw, nil
 }
 
 // Call calls a RPC method and returns coresponding object
 func (p *WSProvider) Call(result interface{}, method string, params ...interface{}) error {
-	receiver := make(chan *jsonrpc2.JSONRPCMessage)
-	err := p.makeRequest(receiver, method, params)
+	resp, err := p.call(method, params)
 	if err != nil {
-		return fmt.Errorf("call: %s", err)
+		return err
 	}
+	return provider.DecodeResult(resp, result)
+}
 
-	var resp *jsonrpc2.JSONRPCMessage
-	select {
-	case resp = <-receiver:
-		break
-	case <-p.cancel:
-		return etherr.ConnectionClosed
+// SetHeader sets a header sent with the handshake of every connection, like an api key
+func (p *WSProvider) SetHeader(key, value string) {
+	p.header.Set(key, value)
+}
+
+// SetHeaderFunc sets a function called before every connection for headers changing over
+// time, like rotating tokens. Its headers take precedence over the static ones.
+func (p *WSProvider) SetHeaderFunc(f func() (http.Header, error)) {
+	p.headerFunc = f
+}
+
+// SetSingleflight enables or disables sharing the response of a call with the identical
+// calls made while it is in flight
+func (p *WSProvider) SetSingleflight(enabled bool) {
+	p.flights = nil
+	if enabled {
+		p.flights = &singleflight.Group{}
 	}
+}
 
-	null := string(json.RawMessage([]byte("null")))
-	if string(resp.Result) == null {
-		return etherr.Nil
+// call waits for the response of a request, or for the one of an identical request in
+// flight in singleflight mode
+func (p *WSProvider) call(method string, params []interface{}) (*jsonrpc2.JSONRPCMessage, error) {
+	if p.flights == nil || !provider.Shareable(method) {
+		return p.roundTrip(method, params)
+	}
+	key, err := jsonrpc2.RequestKey(method, params)
+	if err != nil {
+		return p.roundTrip(method, params)
 	}
 
-	if resp.Error != nil {
-		switch resp.Error.Code {
-		case -32015: // VM execution error
-			err := etherr.VMExecutionError.(*etherr.RpcError)
-			err.Code = resp.Error.Code
-			err.Details = resp.Error.Data
-			return err
-		default:
-			return etherr.New(resp.Error.Message, resp.Error.Code, resp.Error.Data)
-		}
+	v, err, _ := p.flights.Do(key, func() (interface{}, error) {
+		return p.roundTrip(method, params)
+	})
+	resp, _ := v.(*jsonrpc2.JSONRPCMessage)
+	return resp, err
+}
+
+// roundTrip sends a request and waits for its response
+func (p *WSProvider) roundTrip(method string, params []interface{}) (*jsonrpc2.JSONRPCMessage, error) {
+	resp, _, err := p.request(method, params)
+	return resp, err
+}
+
+// request sends a request and waits for its response, it returns the cancel channel of
+// the connection that answered
+func (p *WSProvider) request(method string, params []interface{}) (*jsonrpc2.JSONRPCMessage, chan struct{}, error) {
+	id := jsonrpc2.NextID()
+	request, err := jsonrpc2.EncodeClientRequest(method, params, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("call: %s", err)
 	}
 
-	err = json.Unmarshal(resp.Result, &result)
+	responses, cancel, err := p.exchange([]string{id}, request, false)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	return nil
+	return responses[0], cancel, nil
 }
 
-// Subscribe creates a subscription to event using method
+// Subscribe creates a subscription to event using method. Notifications are delivered in
+// order, what happens when the receiver is full depends on the OverflowPolicy.
 func (p *WSProvider) Subscribe(receiver chan *json.RawMessage, method string, event string, params ...interface{}) error {
-	var subscriptionID string
-	pa := append([]interface{}{}, event)
-	pa = append(pa, params...)
+	return p.SubscribeErr(receiver, nil, method, event, params...)
+}
+
+// SubscribeErr is Subscribe with errs receiving the errors of the subscription, see provider.ErrSubscriber
+func (p *WSProvider) SubscribeErr(receiver chan *json.RawMessage, errs chan error, method string, event string, params ...interface{}) error {
+	return p.subscribe(&subscription{
+		receiver: receiver,
+		errs:     errs,
+		method:   method,
+		event:    event,
+		params:   params,
+	})
+}
+
+// subscribe makes the subscription on the current connection and registers it
+func (p *WSProvider) subscribe(sub *subscription) error {
+	pa := append([]interface{}{}, sub.event)
+	pa = append(pa, sub.params...)
 
-	err := p.Call(&subscriptionID, method, pa...)
+	// the subscription belongs to the connection that answered
+	resp, cancel, err := p.request(sub.method, pa)
 	if err != nil {
 		return fmt.Errorf("subscription creation: %s", err)
 	}
+	var subscriptionID string
+	if err := provider.DecodeResult(resp, &subscriptionID); err != nil {
+		return fmt.Errorf("subscription creation: %s", err)
+	}
 
 	p.mu.Lock()
-	p.subscriptions[subscriptionID] = receiver
-	p.mu.Unlock()
+	defer p.mu.Unlock()
+	select {
+	case <-cancel:
+		// the receive pump of the connection already closed its subscriptions
+		return fmt.Errorf("subscription creation: %s", etherr.ConnectionClosed)
+	default:
+	}
+	sub.cancel = cancel
+	sub.cause = nil
+	sub.last = time.Now()
+	sub.id = subscriptionID
+	if sub.delivery == nil {
+		sub.delivery = provider.NewDelivery(sub.receiver, sub.errs, p.deliverer(sub), p.maxQueued)
+	}
+	p.subscriptions[subscriptionID] = sub
 
 	return nil
 }
 
-// unsubscribe closes a subscription
-// TODO this should be available to the outside world as well, but subscriptionID is not public
-func (p *WSProvider) unsubscribe(subscriptionID string) {
+// deliverer hands the notifications of sub to its receiver following the overflow policy,
+// from the delivery of the subscription
+func (p *WSProvider) deliverer(sub *subscription) provider.Deliver {
+	return func(receiver chan *json.RawMessage, n *json.RawMessage, ended chan struct{}) {
+		dropped, ok := p.overflow.deliver(receiver, n, ended)
+		p.mu.Lock()
+		p.dropped += dropped
+		p.mu.Unlock()
+		if !ok {
+			p.overflowed(sub)
+		}
+	}
+}
+
+// overflowed terminates a subscription whose receiver or queue is full, and tells the
+// node to stop sending
+func (p *WSProvider) overflowed(sub *subscription) {
 	p.mu.Lock()
-	close(p.subscriptions[subscriptionID])
-	delete(p.subscriptions, subscriptionID)
+	p.overflows++
+	id := sub.id
 	p.mu.Unlock()
+
+	p.log.Warnf("subscription %s overflowed, terminating it", id)
+	p.end(id, sub, etherr.SubscriptionOverflow)
+	// the receive pump can not wait for the answer it has to read itself
+	go p.Call(new(bool), strings.Replace(sub.method, "_subscribe", "_unsubscribe", 1), id)
 }
 
-func (p *WSProvider) makeRequest(receiver chan *jsonrpc2.JSONRPCMessage, method string, params []interface{}) error {
-	p.deadMu.Lock()
-	dead := p.dead
-	p.deadMu.Unlock()
-	if dead {
-		return etherr.ConnectionClosed
+// end closes a subscription after handing it the notifications queued and the cause
+func (p *WSProvider) end(subscriptionID string, sub *subscription, cause error) {
+	p.mu.Lock()
+	if p.subscriptions[subscriptionID] == sub {
+		delete(p.subscriptions, subscriptionID)
 	}
+	p.mu.Unlock()
 
-	id := strconv.FormatInt(rand.Int63(), 16)
-	request, err := jsonrpc2.EncodeClientRequest(method, params, id)
+	sub.delivery.End(cause)
+}
+
+// CallBatch sends the calls in a single websocket message
+func (p *WSProvider) CallBatch(batch []*provider.BatchElem) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	requests := provider.BatchRequests(batch)
+	payload, err := jsonrpc2.EncodeClientRequests(requests)
 	if err != nil {
 		return err
 	}
+	ids := make([]string, len(requests))
+	for i, r := range requests {
+		ids[i] = r.ID
+	}
 
-	// ensure only one write at a time
-	p.mu.Lock()
-	p.requests[id] = receiver
-	p.mu.Unlock()
+	responses, _, err := p.exchange(ids, payload, true)
+	if err != nil {
+		return err
+	}
 
-	// sending request to write pump
-	p.send <- request
+	provider.DecodeBatch(batch, requests, responses)
 	return nil
 }
 
-func (p *WSProvider) connect() error {
+// exchange hands the message to the send pump and waits for the responses to ids, until
+// the connection dies or the call timeout. It returns the cancel channel of the connection.
+// A batch ends with the array answering it, the requests left out get no response; a
+// batch rejected as a whole fails with the error of the node.
+func (p *WSProvider) exchange(ids []string, message []byte, batch bool) ([]*jsonrpc2.JSONRPCMessage, chan struct{}, error) {
+	p.deadMu.Lock()
+	dead := p.dead
+	send, cancel := p.send, p.cancel
+	p.deadMu.Unlock()
+	if dead {
+		return nil, nil, etherr.ConnectionClosed
+	}
+
+	responses, err := p.pending.Exchange(ids, batch, cancel, p.callTimeout, func(timeout <-chan time.Time) error {
+		// sending request to write pump
+		select {
+		case send <- message:
+			return nil
+		case <-cancel:
+			return etherr.ConnectionClosed
+		case <-timeout:
+			return etherr.RequestTimeout
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return responses, cancel, nil
+}
+
+func (p *WSProvider) connect() (*websocket.Conn, error) {
 	r := rate.Every(time.Minute)
 	limiter := rate.NewLimiter(r, 1)
-	log.Debugf("connecting to server on %s", p.url.String())
+	p.log.Debugf("connecting to server on %s", p.url.String())
 	for {
-		c, _, err := websocket.DefaultDialer.Dial(p.url.String(), nil)
+		c, err := p.dial()
 		if err != nil {
 			if limiter.Allow() {
-				log.Warnf("error connecting to server: %s ", err)
+				p.log.Warnf("error connecting to server: %s ", err)
 			}
-			if p.retry {
+			if p.retry && !p.isStopped() {
 				time.Sleep(time.Second)
 				continue
 			} else {
-				return err
+				return nil, err
 			}
 
 		}
-		log.Debugln("connected to server over websockets")
-		p.client = c
-
-		// TODO disable for now check https://github.com/gorilla/websocket/issues/355
-		//c.SetReadDeadline(time.Now().Add(pongWait))
-		c.SetPongHandler(p.handlePong)
-		//connected and subscribed, leave
-		break
+		p.log.Debugf("connected to server over websockets")
+
+		// a peer that stops answering the pings kills the connection, the pongs are read by
+		// the receive pump: the deadline is only ever set from its goroutine
+		c.SetReadDeadline(time.Now().Add(p.pongWait))
+		c.SetPongHandler(func(string) error {
+			return c.SetReadDeadline(time.Now().Add(p.pongWait))
+		})
+		return c, nil
 	}
-
-	return nil
 }
 
-func (p *WSProvider) handlePong(string) error {
-	//p.client.SetReadDeadline(time.Now().Add(pongWait))
-	return nil
+// dial opens a connection with the static headers and the ones of the header function
+func (p *WSProvider) dial() (*websocket.Conn, error) {
+	header := make(http.Header)
+	provider.MergeHeaders(header, p.header)
+	if p.headerFunc != nil {
+		h, err := p.headerFunc()
+		if err != nil {
+			return nil, err
+		}
+		provider.MergeHeaders(header, h)
+	}
+
+	c, _, err := p.dialer.Dial(p.url.String(), header)
+	return c, err
 }
 
-func (p *WSProvider) receivePump() {
+// receivePump reads the messages of c until it dies, handling them in order. It queues the
+// notifications of the subscriptions of c, never waiting for their receivers, and ends
+// them when it ends, or hands them over to the reconnection.
+func (p *WSProvider) receivePump(c *websocket.Conn, cancel chan struct{}) {
 	for {
-		_, message, err := p.client.ReadMessage()
+		_, message, err := c.ReadMessage()
 		if err != nil {
-			log.Debugf("message read error: %s", err)
-			p.fatality()
+			p.log.Debugf("message read error: %s", err)
+			p.fatality(c, etherr.ConnectionLost(err))
+			p.connectionEnded(cancel, etherr.ConnectionLost(err))
 			return
 		}
-		msg, err := jsonrpc2.DecodeResponse(message)
-		if err != nil {
-			log.Warnf("decode rpc message: %s", err)
-		}
-		// TODO this has the potential to block the queue lower down the line
-		// move to go routine, add some auto expiry for channels that never got called
-		// look into how a channel might get blocked and never get called
-		go p.handleMessage(msg)
+		// any message shows the peer is alive, not only the pongs
+		c.SetReadDeadline(time.Now().Add(p.pongWait))
 
+		p.pending.Receive(message, func(msg *jsonrpc2.JSONRPCMessage) {
+			p.handleMessage(msg, cancel)
+		})
 	}
 }
 
-func (p *WSProvider) sendPump() {
-	ticker := time.NewTicker(pingPeriod)
+func (p *WSProvider) sendPump(c *websocket.Conn, send chan []byte, cancel chan struct{}) {
+	ticker := time.NewTicker(p.pingPeriod)
 	defer func() {
 		ticker.Stop()
-		p.client.Close()
+		c.Close()
 	}()
 	for {
 		select {
-		case message, ok := <-p.send:
-			p.client.SetWriteDeadline(time.Now().Add(writeWait))
+		case message, ok := <-send:
+			c.SetWriteDeadline(time.Now().Add(p.writeWait))
 			if !ok {
 				// The hub closed the channel.
-				p.client.WriteMessage(websocket.CloseMessage, []byte{})
-				log.Warn("hub close the channel. investigate!!")
-				p.fatality()
+				c.WriteMessage(websocket.CloseMessage, []byte{})
+				p.log.Warnf("hub close the channel. investigate!!")
+				p.fatality(c, etherr.ConnectionClosed)
 				return
 			}
 
-			w, err := p.client.NextWriter(websocket.TextMessage)
+			w, err := c.NextWriter(websocket.TextMessage)
 			if err != nil {
-				log.Warnf("websocket writer: %s", err)
-				p.fatality()
+				p.log.Warnf("websocket writer: %s", err)
+				p.fatality(c, etherr.ConnectionLost(err))
 				return
 			}
 			w.Write(message)
 
 			if err := w.Close(); err != nil {
-				log.Warnf("websocket connection closed: %s", err)
-				p.fatality()
+				p.log.Warnf("websocket connection closed: %s", err)
+				p.fatality(c, etherr.ConnectionLost(err))
 				return
 			}
 		case <-ticker.C:
-			p.client.SetWriteDeadline(time.Now().Add(writeWait))
-			err := p.client.WriteMessage(websocket.PingMessage, nil)
+			c.SetWriteDeadline(time.Now().Add(p.writeWait))
+			err := c.WriteMessage(websocket.PingMessage, nil)
 			if err != nil {
-				log.Warnf("set write deadline: %s", err)
-				p.fatality()
+				p.log.Warnf("set write deadline: %s", err)
+				p.fatality(c, etherr.ConnectionLost(err))
 				return
 			}
-		case <-p.cancel:
+		case <-cancel:
 			// ending the misery
 			return
 		}
 	}
 }
 
-func (p *WSProvider) handleMessage(msg *jsonrpc2.JSONRPCMessage) {
+// handleMessage hands a message read on the connection of cancel to its receiver
+func (p *WSProvider) handleMessage(msg *jsonrpc2.JSONRPCMessage, cancel chan struct{}) {
 	switch {
 	case msg.IsNotification():
 		if !strings.HasSuffix(msg.Method, "_subscription") {
-			log.Warn(fmt.Sprint("dropping non-subscription message: ", msg))
+			p.log.Warnf("dropping non-subscription message: %s", msg)
 			return
 		}
 		var notification jsonrpc2.JSONRPCNotification
 
 		if err := json.Unmarshal(msg.Params, &notification); err != nil {
-			log.Warnf(fmt.Sprint("dropping invalid subscription message: ", msg))
+			p.log.Warnf("dropping invalid subscription message: %s", msg)
 			return
 		}
 		id, err := notification.ValidID()
 		if err != nil {
-			log.Warn("notification json id", err)
+			p.log.Warnf("notification json id: %s", err)
+			return
 		}
 
+		// a subscription of a previous connection may have been renewed under the same id
 		p.mu.Lock()
-		c := p.subscriptions[id]
-		p.mu.Unlock()
-
-		c <- &notification.Result
-
-	case msg.IsResponse():
-		id, err := msg.ValidID()
-		if err != nil {
-			log.Warn("response json id", err)
+		sub, ok := p.subscriptions[id]
+		ok = ok && sub.cancel == cancel
+		if ok {
+			sub.last = time.Now()
 		}
-
-		p.mu.Lock()
-		c := p.requests[id]
-		delete(p.requests, id)
 		p.mu.Unlock()
-
-		c <- msg
+		if !ok {
+			return
+		}
+		if notification.Error != nil {
+			sub.delivery.Err(etherr.New(notification.Error.Message, notification.Error.Code, notification.Error.Data))
+			return
+		}
+		if !sub.delivery.Notify(&notification.Result) {
+			p.overflowed(sub)
+		}
 
 	default:
-		log.Warnf("message not handled: %s", msg.String())
+		p.log.Warnf("message not handled: %s", msg.String())
 	}
 }
 
-func (p *WSProvider) fatality() {
+// fatality closes the connection c, killing the requests if it is the current one. The
+// receive pump ends the subscriptions, with the cause.
+func (p *WSProvider) fatality(c *websocket.Conn, cause error) {
 	p.deadMu.Lock()
-	if !p.dead {
+	if !p.dead && c == p.client {
 		p.dead = true
 
+		// the subscriptions learn why the connection died when the receive pump ends them
+		p.mu.Lock()
+		for _, sub := range p.subscriptions {
+			if sub.cancel == p.cancel && sub.cause == nil {
+				sub.cause = cause
+			}
+		}
+		p.mu.Unlock()
+
 		// kill any ongoing requests
 		close(p.cancel)
-		// kill any subscriptions
-		for k := range p.subscriptions {
-			p.unsubscribe(k)
-		}
 	}
 	p.deadMu.Unlock()
 
-	_ = p.client.Close()
+	_ = c.Close()
 }
 
-// New creates a new WSProvider struct
-func New(u string, retry bool) (*WSProvider, error) {
+// New creates a new WSProvider struct configured by the options.
+// The user and password of the url are sent as basic auth.
+func New(u string, retry bool, opts ...Option) (*WSProvider, error) {
+	// websocket urls can not hold credentials, they go in the headers of the handshake
+	u, header, err := provider.StripUserinfo(u)
+	if err != nil {
+		return nil, err
+	}
+
 	// fail early. bail out if the url is invalid
 	url, err := url.Parse(u)
 	if err != nil {
 		return nil, err
 	}
 
-	return &WSProvider{
-			url:           url,
-			retry:         retry,
-			send:          make(chan []byte),
-			requests:      make(map[string]chan *jsonrpc2.JSONRPCMessage),
-			subscriptions: make(map[string]chan *json.RawMessage),
-			cancel:        make(chan struct{}),
-			dead:          true,
-		},
-		nil
+	dialer := *websocket.DefaultDialer
+	p := &WSProvider{
+		url:           url,
+		retry:         retry,
+		header:        header,
+		dialer:        &dialer,
+		writeWait:     DefaultWriteTimeout,
+		pingPeriod:    DefaultPingInterval,
+		pongWait:      DefaultPongTimeout,
+		callTimeout:   DefaultCallTimeout,
+		log:           logger.Default(),
+		send:          make(chan []byte),
+		subscriptions: make(map[string]*subscription),
+		cancel:        make(chan struct{}),
+		dead:          true,
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	if p.pingPeriod >= p.pongWait {
+		return nil, fmt.Errorf("Ping interval must be less than the pong timeout")
+	}
+	p.pending = provider.NewPending(p.log)
+	return p, nil
 }
@@ -0,0 +1,491 @@
+package wsrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/rpctest"
+)
+
+func TestWSProvider_Call(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	p, err := New(srv.WSURL, false)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, "0x10", result)
+
+	raw, err := p.CallRaw("eth_blockNumber")
+	assert.NoError(t, err)
+	assert.Contains(t, string(raw), `"result":"0x10"`)
+}
+
+func TestWSProvider_Subscribe(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+
+	p, err := New(srv.WSURL, false)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	receiver := make(chan *json.RawMessage, 1)
+	assert.NoError(t, p.Subscribe(receiver, "eth_subscribe", "newHeads"))
+
+	n, err := srv.Notify("newHeads", map[string]string{"number": "0x1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.JSONEq(t, `{"number":"0x1"}`, string(*<-receiver))
+}
+
+func TestWSProvider_Reconnect(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	p, err := New(srv.WSURL, false)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	receiver := make(chan *json.RawMessage, 1)
+	assert.NoError(t, p.Subscribe(receiver, "eth_subscribe", "newHeads"))
+
+	// the connection dies, subscriptions are closed and calls fail
+	srv.DropConnections()
+	select {
+	case _, ok := <-receiver:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("subscription not closed")
+	}
+	var result string
+	assert.Error(t, p.Call(&result, "eth_blockNumber"))
+
+	// a new connection works again
+	assert.NoError(t, p.Start())
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, "0x10", result)
+}
+
+func TestWSProvider_Singleflight(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_getTransactionReceipt", map[string]string{"status": "0x1"})
+	srv.SetLatency(50 * time.Millisecond)
+
+	p, err := New(srv.WSURL, false)
+	assert.NoError(t, err)
+	p.SetSingleflight(true)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			raw, err := p.CallRaw("eth_getTransactionReceipt", "0xdead")
+			assert.NoError(t, err)
+			assert.Contains(t, string(raw), `"status":"0x1"`)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, srv.Count("eth_getTransactionReceipt"))
+}
+
+func TestWSProvider_Headers(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+
+	u := strings.Replace(srv.WSURL, "ws://", "ws://user:secret@", 1)
+	p, err := New(u, false)
+	assert.NoError(t, err)
+	p.SetHeader("X-Api-Key", "key")
+	p.SetHeaderFunc(func() (http.Header, error) {
+		return http.Header{"X-Token": []string{"rotated"}}, nil
+	})
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	headers := srv.Headers()
+	assert.Len(t, headers, 1)
+	assert.Equal(t, "key", headers[0].Get("X-Api-Key"))
+	assert.Equal(t, "rotated", headers[0].Get("X-Token"))
+	user, password, ok := (&http.Request{Header: headers[0]}).BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", user)
+	assert.Equal(t, "secret", password)
+}
+
+func TestNew_Options(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	_, err := New(srv.WSURL, false, WithPingInterval(0))
+	assert.Error(t, err)
+
+	p, err := New(srv.WSURL, false, WithPingInterval(time.Second), WithWriteTimeout(time.Second), WithBufferSizes(1024, 1024))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, "0x10", result)
+}
+
+func TestWSProvider_OverflowPolicy(t *testing.T) {
+	notify := func(t *testing.T, policy OverflowPolicy) (*WSProvider, *rpctest.Server, chan *json.RawMessage, chan error) {
+		srv := rpctest.NewServer()
+		p, err := New(srv.WSURL, false, WithOverflowPolicy(policy))
+		assert.NoError(t, err)
+		assert.NoError(t, p.Start())
+
+		receiver := make(chan *json.RawMessage, 2)
+		errs := make(chan error, 1)
+		assert.NoError(t, p.SubscribeErr(receiver, errs, "eth_subscribe", "newHeads"))
+		for _, n := range []string{"0x1", "0x2", "0x3", "0x4"} {
+			_, err := srv.Notify("newHeads", n)
+			assert.NoError(t, err)
+		}
+		return p, srv, receiver, errs
+	}
+	waitDropped := func(t *testing.T, p *WSProvider, n int) {
+		deadline := time.Now().Add(time.Second)
+		for p.Stats().DroppedNotifications < n && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, n, p.Stats().DroppedNotifications)
+	}
+	heads := func(receiver chan *json.RawMessage) []string {
+		var got []string
+		for len(receiver) > 0 {
+			got = append(got, string(*<-receiver))
+		}
+		return got
+	}
+
+	t.Run("drop newest", func(t *testing.T) {
+		p, srv, receiver, _ := notify(t, DropNewest)
+		defer srv.Close()
+		defer p.Stop()
+
+		waitDropped(t, p, 2)
+		assert.Equal(t, []string{`"0x1"`, `"0x2"`}, heads(receiver))
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		p, srv, receiver, _ := notify(t, DropOldest)
+		defer srv.Close()
+		defer p.Stop()
+
+		waitDropped(t, p, 2)
+		assert.Equal(t, []string{`"0x3"`, `"0x4"`}, heads(receiver))
+	})
+
+	t.Run("terminate", func(t *testing.T) {
+		p, srv, receiver, errs := notify(t, Terminate)
+		defer srv.Close()
+		defer p.Stop()
+
+		select {
+		case err := <-errs:
+			assert.Equal(t, etherr.SubscriptionOverflow, err)
+		case <-time.After(time.Second):
+			t.Fatal("subscription not terminated")
+		}
+		assert.Equal(t, 1, p.Stats().Overflows)
+		assert.Equal(t, []string{`"0x1"`, `"0x2"`}, heads(receiver))
+		_, ok := <-receiver
+		assert.False(t, ok)
+
+		// the node is told to stop sending
+		deadline := time.Now().Add(time.Second)
+		for srv.Subscriptions("newHeads") > 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.Equal(t, 0, srv.Subscriptions("newHeads"))
+	})
+
+	_, err := New("ws://localhost:8546", false, WithOverflowPolicy(OverflowPolicy(42)))
+	assert.Error(t, err)
+}
+
+func TestWSProvider_OrderedDelivery(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+
+	p, err := New(srv.WSURL, false)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	// a consumer slower than the node, with the default policy nothing is lost or reordered
+	receiver := make(chan *json.RawMessage)
+	assert.NoError(t, p.Subscribe(receiver, "eth_subscribe", "newHeads"))
+	go func() {
+		for i := 0; i < 100; i++ {
+			srv.Notify("newHeads", i)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		var n int
+		assert.NoError(t, json.Unmarshal(*<-receiver, &n))
+		assert.Equal(t, i, n)
+	}
+	assert.Equal(t, 0, p.Stats().DroppedNotifications)
+}
+
+func TestWSProvider_StartTwice(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	p, err := New(srv.WSURL, false)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	// the live connection is kept
+	assert.NoError(t, p.Start())
+	assert.Equal(t, 0, p.Stats().Reconnects)
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+}
+
+func TestWSProvider_SlowSubscriber(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	p, err := New(srv.WSURL, false)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	// nobody reads the receiver while the notifications come
+	receiver := make(chan *json.RawMessage)
+	assert.NoError(t, p.Subscribe(receiver, "eth_subscribe", "newHeads"))
+	for i := 0; i < 10; i++ {
+		_, err := srv.Notify("newHeads", i)
+		assert.NoError(t, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().SubscriptionBacklog < 10 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 10, p.Stats().SubscriptionBacklog)
+
+	// the responses do not wait behind them
+	done := make(chan error, 1)
+	go func() {
+		var result string
+		done <- p.Call(&result, "eth_blockNumber")
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("call held back by the subscriber")
+	}
+
+	for i := 0; i < 10; i++ {
+		var n int
+		assert.NoError(t, json.Unmarshal(*<-receiver, &n))
+		assert.Equal(t, i, n)
+	}
+}
+
+func TestWSProvider_MaxQueued(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+
+	p, err := New(srv.WSURL, false, WithMaxQueued(3))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	// nobody reads the receiver, its queue fills up
+	receiver := make(chan *json.RawMessage)
+	errs := make(chan error, 1)
+	assert.NoError(t, p.SubscribeErr(receiver, errs, "eth_subscribe", "newHeads"))
+	for i := 0; i < 10; i++ {
+		_, err := srv.Notify("newHeads", i)
+		assert.NoError(t, err)
+	}
+
+	select {
+	case err := <-errs:
+		assert.Equal(t, etherr.SubscriptionOverflow, err)
+	case <-time.After(time.Second):
+		t.Fatal("subscription not terminated")
+	}
+	_, ok := <-receiver
+	assert.False(t, ok)
+	assert.Equal(t, 1, p.Stats().Overflows)
+
+	// the node is told to stop sending
+	deadline := time.Now().Add(time.Second)
+	for srv.Subscriptions("newHeads") > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, srv.Subscriptions("newHeads"))
+
+	_, err = New(srv.WSURL, false, WithMaxQueued(0))
+	assert.Error(t, err)
+}
+
+func TestWSProvider_CallTimeout(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	p, err := New(srv.WSURL, false, WithCallTimeout(30*time.Millisecond))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	srv.SetLatency(100 * time.Millisecond)
+	var result string
+	assert.Equal(t, etherr.RequestTimeout, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, 0, p.Stats().PendingRequests, "the request is forgotten")
+
+	// the late response is dropped, the connection goes on
+	time.Sleep(150 * time.Millisecond)
+	srv.SetLatency(0)
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.Equal(t, "0x10", result)
+	assert.Equal(t, 0, p.Stats().PendingRequests)
+
+	_, err = New(srv.WSURL, false, WithCallTimeout(-time.Second))
+	assert.Error(t, err)
+	_, err = New(srv.WSURL, false, WithCallTimeout(0))
+	assert.Error(t, err, "calls can not wait forever")
+
+	// a node that never answers does not hang the callers
+	p, err = New(srv.WSURL, false)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultCallTimeout, p.callTimeout)
+}
+
+func TestWSProvider_SequentialIDs(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	p, err := New(srv.WSURL, false)
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+
+	requests := srv.Requests()
+	var first, second string
+	assert.NoError(t, json.Unmarshal(requests[0].ID, &first))
+	assert.NoError(t, json.Unmarshal(requests[1].ID, &second))
+	a, err := strconv.ParseUint(first, 10, 64)
+	assert.NoError(t, err)
+	b, err := strconv.ParseUint(second, 10, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, a+1, b)
+}
+
+func TestWSProvider_PongTimeout(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle("eth_blockNumber", "0x10")
+
+	p, err := New(srv.WSURL, false, WithPingInterval(20*time.Millisecond), WithPongTimeout(60*time.Millisecond))
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+	defer p.Stop()
+
+	receiver := make(chan *json.RawMessage, 1)
+	errs := make(chan error, 1)
+	assert.NoError(t, p.SubscribeErr(receiver, errs, "eth_subscribe", "newHeads"))
+
+	// quiet but alive, the pongs keep the connection open
+	time.Sleep(150 * time.Millisecond)
+	var result string
+	assert.NoError(t, p.Call(&result, "eth_blockNumber"))
+
+	// a peer busy with a request reads nothing, not even the pings
+	srv.SetLatency(500 * time.Millisecond)
+	go p.Call(&result, "eth_blockNumber")
+	select {
+	case err := <-errs:
+		assert.Contains(t, err.Error(), "timeout")
+	case <-time.After(time.Second):
+		t.Fatal("dead peer not detected")
+	}
+	_, ok := <-receiver
+	assert.False(t, ok)
+
+	_, err = New(srv.WSURL, false, WithPingInterval(time.Minute))
+	assert.Error(t, err, "the ping interval must be less than the pong timeout")
+}
+
+func TestWSProvider_StallTimeout(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+
+	p, err := New(srv.WSURL, false, WithStallTimeout("newHeads", 200*time.Millisecond), WithAutoReconnect())
+	assert.NoError(t, err)
+	assert.NoError(t, p.Start())
+
+	receiver := make(chan *json.RawMessage, 1)
+	errs := make(chan error, 1)
+	assert.NoError(t, p.SubscribeErr(receiver, errs, "eth_subscribe", "newHeads"))
+
+	// no head for too long, the connection is replaced and the subscription renewed
+	select {
+	case err := <-errs:
+		assert.Equal(t, etherr.SubscriptionStalled, err)
+	case <-time.After(time.Second):
+		t.Fatal("stall not detected")
+	}
+	deadline := time.Now().Add(time.Second)
+	for (p.Stats().Reconnects < 1 || p.Stats().Subscriptions < 1) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 1, p.Stats().Stalls)
+	assert.Equal(t, 1, srv.Subscriptions("newHeads"))
+
+	_, err = srv.Notify("newHeads", "0x1")
+	assert.NoError(t, err)
+	select {
+	case n := <-receiver:
+		assert.Equal(t, `"0x1"`, string(*n))
+	case <-time.After(time.Second):
+		t.Fatal("renewed subscription got nothing")
+	}
+
+	// Stop is final
+	p.Stop()
+	select {
+	case _, ok := <-receiver:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("subscription not closed by Stop")
+	}
+	assert.Equal(t, etherr.ConnectionClosed, <-errs)
+}
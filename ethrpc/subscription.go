@@ -0,0 +1,190 @@
+package ethrpc
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/ethrpc/provider"
+	"github.com/alethio/web3-go/types"
+)
+
+// errBuffer is the number of errors a subscription keeps for a consumer not reading them
+const errBuffer = 16
+
+// Subscription is the error side of a subscription. Err receives the notifications that
+// can not be decoded and the errors sent by the node, the subscription goes on after them.
+// When it ends its last error is the cause, like the loss of the connection, then Err is
+// closed: the consumer can resubscribe.
+type Subscription struct {
+	errs chan error
+}
+
+// Err returns the errors of the subscription, closed when the subscription ended
+func (s *Subscription) Err() <-chan error {
+	return s.errs
+}
+
+// send hands err to the consumer without waiting, the oldest error is dropped when Err
+// is full. The subscription goroutine is the only sender.
+func (s *Subscription) send(err error) {
+	for {
+		select {
+		case s.errs <- err:
+			return
+		default:
+		}
+		select {
+		case <-s.errs:
+		default:
+		}
+	}
+}
+
+// HeadsSubscription delivers the heads of the new blocks
+type HeadsSubscription struct {
+	*Subscription
+	// Heads is closed when the subscription ends
+	Heads <-chan *types.BlockHeader
+}
+
+// PendingTransactionsSubscription delivers the hashes of the transactions entering the pool
+type PendingTransactionsSubscription struct {
+	*Subscription
+	// Hashes is closed when the subscription ends
+	Hashes <-chan *string
+}
+
+// BlockNumberSubscription delivers the numbers of the new blocks
+type BlockNumberSubscription struct {
+	*Subscription
+	// Numbers is closed when the subscription ends
+	Numbers <-chan *int64
+}
+
+// SubscribeNewHeads eth_subscribe to newHeads
+func (e *ETH) SubscribeNewHeads() (*HeadsSubscription, error) {
+	heads := make(chan *types.BlockHeader, e.bufferSize(100))
+	s, err := e.subscribeNewHeads(heads)
+	if err != nil {
+		return nil, err
+	}
+	return &HeadsSubscription{Subscription: s, Heads: heads}, nil
+}
+
+// SubscribeNewPendingTransactions eth_subscribe to newPendingTransactions
+func (e *ETH) SubscribeNewPendingTransactions() (*PendingTransactionsSubscription, error) {
+	hashes := make(chan *string, e.bufferSize(10000))
+	s, err := e.subscribeNewPendingTransactions(hashes)
+	if err != nil {
+		return nil, err
+	}
+	return &PendingTransactionsSubscription{Subscription: s, Hashes: hashes}, nil
+}
+
+// SubscribeBlockNumber parity_subscribe to eth_blockNumber
+func (e *ETH) SubscribeBlockNumber() (*BlockNumberSubscription, error) {
+	numbers := make(chan *int64, e.bufferSize(10000))
+	s, err := e.subscribeBlockNumber(numbers)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockNumberSubscription{Subscription: s, Numbers: numbers}, nil
+}
+
+func (e *ETH) subscribeNewHeads(heads chan *types.BlockHeader) (*Subscription, error) {
+	return e.subscribe(cap(heads), func(raw json.RawMessage) error {
+		var head types.BlockHeader
+		if err := json.Unmarshal(raw, &head); err != nil {
+			return err
+		}
+		heads <- &head
+		return nil
+	}, func() { close(heads) }, ETHSubscribe, ETHNewHeads)
+}
+
+func (e *ETH) subscribeNewPendingTransactions(hashes chan *string) (*Subscription, error) {
+	return e.subscribe(cap(hashes), func(raw json.RawMessage) error {
+		var hash string
+		if err := json.Unmarshal(raw, &hash); err != nil {
+			return err
+		}
+		hashes <- &hash
+		return nil
+	}, func() { close(hashes) }, ETHSubscribe, ETHNewPendingTransactions)
+}
+
+func (e *ETH) subscribeBlockNumber(numbers chan *int64) (*Subscription, error) {
+	return e.subscribe(cap(numbers), func(raw json.RawMessage) error {
+		var bn string
+		if err := json.Unmarshal(raw, &bn); err != nil {
+			return err
+		}
+		n, err := strconv.ParseInt(bn, 0, 64)
+		if err != nil {
+			return err
+		}
+		numbers <- &n
+		return nil
+	}, func() { close(numbers) }, ParitySubscribe, ETHBlockNumber, []string{})
+}
+
+// subscribe creates a subscription to event and hands its notifications to decode until
+// it ends, then calls done. The decode errors and the ones of the provider go to Err.
+func (e *ETH) subscribe(size int, decode func(json.RawMessage) error, done func(), method string, event string, params ...interface{}) (*Subscription, error) {
+	receiver := make(chan *json.RawMessage, size)
+	// the provider may send after the end, this one is never closed
+	providerErrs := make(chan error, errBuffer)
+	s := &Subscription{errs: make(chan error, errBuffer)}
+
+	go func() {
+		defer done()
+		// the last error of the provider, it is the cause if the receiver is closed right after
+		var last error
+		for {
+			select {
+			case notification, ok := <-receiver:
+				if !ok {
+					// the cause is sent before the receiver is closed
+					for len(providerErrs) > 0 {
+						last = <-providerErrs
+						s.send(last)
+					}
+					if last == nil {
+						s.send(etherr.ConnectionClosed)
+					}
+					close(s.errs)
+					return
+				}
+				last = nil
+				if notification == nil {
+					continue
+				}
+				if err := decode(*notification); err != nil {
+					s.send(&NotificationError{Event: event, Raw: *notification, Err: err})
+				}
+			case err := <-providerErrs:
+				s.send(err)
+				last = err
+			}
+		}
+	}()
+
+	if err := provider.SubscribeErr(e.rpc, receiver, providerErrs, method, event, params...); err != nil {
+		// the provider did not keep the receiver, ending the subscription is up to us
+		close(receiver)
+		return nil, err
+	}
+	return s, nil
+}
+
+// NotificationError is the error of a notification that could not be decoded
+type NotificationError struct {
+	Event string
+	Raw   json.RawMessage
+	Err   error
+}
+
+func (e *NotificationError) Error() string {
+	return e.Event + " notification: " + e.Err.Error()
+}
@@ -0,0 +1,116 @@
+package ethrpc
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/etherr"
+	"github.com/alethio/web3-go/rpctest"
+)
+
+func nextErr(t *testing.T, errs <-chan error) error {
+	select {
+	case err := <-errs:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("no error")
+		return nil
+	}
+}
+
+func testSubscribeNewHeads(t *testing.T, srv *rpctest.Server, eth *ETH) {
+	sub, err := eth.SubscribeNewHeads()
+	assert.NoError(t, err)
+
+	// a head that can not be decoded is reported, the subscription goes on
+	_, err = srv.Notify(ETHNewHeads, "not a head")
+	assert.NoError(t, err)
+	notifErr, ok := nextErr(t, sub.Err()).(*NotificationError)
+	if assert.True(t, ok) {
+		assert.Equal(t, ETHNewHeads, notifErr.Event)
+		assert.Equal(t, `"not a head"`, string(notifErr.Raw))
+	}
+
+	// so is an error sent by the node
+	assert.Equal(t, 1, srv.NotifyError(ETHNewHeads, -32000, "filter not found"))
+	rpcErr, ok := nextErr(t, sub.Err()).(*etherr.RpcError)
+	if assert.True(t, ok) {
+		assert.Equal(t, -32000, rpcErr.Code)
+	}
+
+	_, err = srv.Notify(ETHNewHeads, map[string]string{"number": "0x1"})
+	assert.NoError(t, err)
+	select {
+	case head := <-sub.Heads:
+		assert.Equal(t, "0x1", head.Number)
+	case <-time.After(time.Second):
+		t.Fatal("no head")
+	}
+
+	// the loss of the connection is the last error, then everything is closed
+	srv.DropConnections()
+	assert.Contains(t, nextErr(t, sub.Err()).Error(), "Connection lost")
+	select {
+	case _, ok := <-sub.Err():
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("errors not closed")
+	}
+	_, ok = <-sub.Heads
+	assert.False(t, ok)
+}
+
+func TestSubscribeNewHeads_WS(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle(WEB3ClientVersion, "Geth/v1.9.0")
+
+	eth, err := NewWithOptions(srv.WSURL, WithReconnect(false))
+	assert.NoError(t, err)
+	defer eth.Stop()
+
+	testSubscribeNewHeads(t, srv, eth)
+}
+
+func TestSubscribeNewHeads_IPC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethrpc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle(WEB3ClientVersion, "Geth/v1.9.0")
+	path := filepath.Join(dir, "geth.ipc")
+	assert.NoError(t, srv.ListenUnix(path))
+
+	eth, err := NewWithOptions(path)
+	assert.NoError(t, err)
+	defer eth.Stop()
+
+	testSubscribeNewHeads(t, srv, eth)
+}
+
+func TestSubscribeBlockNumber_Stop(t *testing.T) {
+	srv := rpctest.NewServer()
+	defer srv.Close()
+	srv.Handle(WEB3ClientVersion, "Parity-Ethereum/v2.5.0")
+
+	eth, err := NewWithOptions(srv.WSURL, WithReconnect(false))
+	assert.NoError(t, err)
+
+	sub, err := eth.SubscribeBlockNumber()
+	assert.NoError(t, err)
+	_, err = srv.Notify(ETHBlockNumber, "0x10")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(16), *<-sub.Numbers)
+
+	eth.Stop()
+	assert.Equal(t, etherr.ConnectionClosed, nextErr(t, sub.Err()))
+	_, ok := <-sub.Numbers
+	assert.False(t, ok)
+}
@@ -1,11 +1,21 @@
 package jsonrpc2
 
 import (
+	"bytes"
 	"encoding/json"
-	"math/rand"
 	"strconv"
+	"sync/atomic"
 )
 
+// lastID is the id of the last request built in this process
+var lastID uint64
+
+// NextID returns a request id never returned before by this process, ids are sequential
+// so the requests in flight on a connection can not collide
+func NextID() string {
+	return strconv.FormatUint(atomic.AddUint64(&lastID, 1), 10)
+}
+
 // EncodeClientRequest encodes parameters for a JSON-RPC client request.
 func EncodeClientRequest(method string, args interface{}, id string) ([]byte, error) {
 	return NewRequest(method, args, id).Encode()
@@ -22,10 +32,9 @@ func EncodeClientRequests(requests []*JSONRPCRequest) ([]byte, error) {
 	return json.Marshal(requests)
 }
 
-// BuildRequest creates a new RPC request struct with a random ID
+// BuildRequest creates a new RPC request struct with the next ID
 func BuildRequest(method string, args interface{}) *JSONRPCRequest {
-	id := strconv.FormatInt(rand.Int63(), 16)
-	return NewRequest(method, args, id)
+	return NewRequest(method, args, NextID())
 }
 
 // NewRequest creates a new RPC requests struct with all attributes required
@@ -38,6 +47,37 @@ func NewRequest(method string, args interface{}, id string) *JSONRPCRequest {
 	}
 }
 
+// RequestKey identifies a call by its method and params, whatever the id: the method, a
+// space and the params. Params are encoded canonically so that equal values give the same
+// key, whatever their go type; no params and null params are an empty array.
+func RequestKey(method string, params interface{}) (string, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return "", err
+	}
+
+	// going through generic values sorts the object keys of structs as well
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", err
+	}
+	if v == nil {
+		v = []interface{}{}
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return method + " " + string(canonical), nil
+}
+
+// Key returns the RequestKey of the request
+func (req *JSONRPCRequest) Key() (string, error) {
+	return RequestKey(req.Method, req.Params)
+}
+
 // DecodeResponse decodes the top level json rpc response for a single rpc call
 func DecodeResponse(response []byte) (*JSONRPCMessage, error) {
 	var message JSONRPCMessage
@@ -82,6 +82,8 @@ func (msg *JSONRPCMessage) String() string {
 type JSONRPCNotification struct {
 	ID     string          `json:"subscription"`
 	Result json.RawMessage `json:"result"`
+	// Error is sent by some nodes instead of a result when the subscription failed
+	Error *JSONRPCError `json:"error,omitempty"`
 }
 
 // ValidID decods the id if it s valid
@@ -0,0 +1,76 @@
+// Package logger is the small logging interface the providers and the ETH log through,
+// with adapters for logrus, slog-style loggers and a no-op logger
+package logger
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Logger is implemented by the loggers of the library. logrus loggers and entries
+// implement it as they are.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// SlogLogger is a structured logger taking a message and key value pairs, like *slog.Logger
+type SlogLogger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Default returns the logger used when none is given, the standard logrus logger
+func Default() Logger {
+	return logrus.StandardLogger()
+}
+
+// Logrus adapts a logrus logger or entry, nil is the standard logrus logger
+func Logrus(l logrus.FieldLogger) Logger {
+	if l == nil {
+		return Default()
+	}
+	return l
+}
+
+// Slog adapts a slog-style logger, the messages are formatted before being handed over
+func Slog(l SlogLogger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l SlogLogger
+}
+
+func (s slogLogger) Debugf(format string, args ...interface{}) {
+	s.l.Debug(fmt.Sprintf(format, args...))
+}
+
+func (s slogLogger) Infof(format string, args ...interface{}) {
+	s.l.Info(fmt.Sprintf(format, args...))
+}
+
+func (s slogLogger) Warnf(format string, args ...interface{}) {
+	s.l.Warn(fmt.Sprintf(format, args...))
+}
+
+func (s slogLogger) Errorf(format string, args ...interface{}) {
+	s.l.Error(fmt.Sprintf(format, args...))
+}
+
+// Nop returns a logger discarding everything
+func Nop() Logger {
+	return nop{}
+}
+
+type nop struct{}
+
+func (nop) Debugf(string, ...interface{}) {}
+func (nop) Infof(string, ...interface{})  {}
+func (nop) Warnf(string, ...interface{})  {}
+func (nop) Errorf(string, ...interface{}) {}
@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type recorder struct {
+	lines []string
+}
+
+func (r *recorder) Debug(msg string, args ...interface{}) { r.lines = append(r.lines, "DEBUG "+msg) }
+func (r *recorder) Info(msg string, args ...interface{})  { r.lines = append(r.lines, "INFO "+msg) }
+func (r *recorder) Warn(msg string, args ...interface{})  { r.lines = append(r.lines, "WARN "+msg) }
+func (r *recorder) Error(msg string, args ...interface{}) { r.lines = append(r.lines, "ERROR "+msg) }
+
+func TestSlog(t *testing.T) {
+	r := &recorder{}
+	l := Slog(r)
+	l.Debugf("connecting to %s", "ws://node")
+	l.Warnf("decode: %d", 42)
+	l.Errorf("gone")
+
+	assert.Equal(t, []string{"DEBUG connecting to ws://node", "WARN decode: 42", "ERROR gone"}, r.lines)
+}
+
+func TestLogrus(t *testing.T) {
+	var out bytes.Buffer
+	base := logrus.New()
+	base.Out = &out
+
+	Logrus(base).Warnf("subscription %s died", "0x1")
+	assert.Contains(t, out.String(), "subscription 0x1 died")
+
+	assert.Equal(t, logrus.StandardLogger(), Logrus(nil))
+}
+
+func TestNop(t *testing.T) {
+	l := Nop()
+	l.Debugf("%s", "nothing")
+	l.Errorf("%s", "nothing")
+}
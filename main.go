@@ -2,17 +2,20 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 
 	"github.com/alethio/web3-go/ethrpc"
 	"github.com/alethio/web3-go/ethrpc/provider/httprpc"
+	"github.com/alethio/web3-go/logger"
 )
 
 type worker struct {
-	eth ethrpc.ETHInterface
+	eth *ethrpc.ETH
+	log logger.Logger
 }
 
 func main() {
@@ -22,139 +25,171 @@ func main() {
 	flag.BoolVar(&batched, "batched", false, "Control wether the client is in batch mode")
 	flag.Parse()
 
+	l := logrus.New()
 	args := flag.Args()
 	if len(args) == 0 {
-		log.Println("Please issue a command:")
-		log.Println("  getBlockNumber")
-		log.Println("  getCode address")
-		log.Println("  newBlockNumberSubscription")
+		l.Println("Please issue a command:")
+		l.Println("  getBlockNumber")
+		l.Println("  getCode address")
+		l.Println("  newBlockNumberSubscription")
 		os.Exit(0)
 	}
-	log.SetLevel(log.DebugLevel)
+	l.SetLevel(logrus.DebugLevel)
 
-	var e *ethrpc.ETH
-	var err error
-	if batched {
-		batchLoader, err := httprpc.NewBatchLoader(0, 4*time.Millisecond)
-		if err != nil {
-			log.Fatal(err)
-		}
-		provider, err := httprpc.NewWithLoader(ethURL, batchLoader)
-		// provider.SetHTTPTimeout(2 * time.Millisecond)
-		if err != nil {
-			log.Fatal(err)
-		}
-		e, err = ethrpc.New(provider)
-	} else {
-		e, err = ethrpc.NewWithDefaults(ethURL)
-	}
+	e, err := connect(ethURL, batched, logger.Logrus(l))
 	if err != nil {
-		log.Fatal(err)
+		l.Fatal(err)
 	}
 	w := worker{
 		eth: e,
+		log: logger.Logrus(l),
+	}
+
+	if err := w.run(args); err != nil {
+		l.Fatal(err)
+	}
+}
+
+// connect creates the ETH on ethURL, logging through log
+func connect(ethURL string, batched bool, log logger.Logger) (*ethrpc.ETH, error) {
+	if !batched {
+		return ethrpc.NewWithOptions(ethURL, ethrpc.WithLogger(log))
+	}
+
+	batchLoader, err := httprpc.NewBatchLoader(0, 4*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := httprpc.NewWithLoader(ethURL, batchLoader)
+	// provider.SetHTTPTimeout(2 * time.Millisecond)
+	if err != nil {
+		return nil, err
 	}
+	e, err := ethrpc.New(provider)
+	if err != nil {
+		return nil, err
+	}
+	e.SetLogger(log)
+	return e, nil
+}
 
+func (w *worker) run(args []string) error {
 	cmd := args[0]
 	switch cmd {
 	case "getBlockNumber":
 		n, err := w.eth.GetBlockNumber()
 		if err != nil {
-			log.Fatal("Eth failed to get block number: ", err)
+			return fmt.Errorf("Eth failed to get block number: %s", err)
 		}
 
-		log.Println(n)
+		w.log.Infof("%d", n)
 	case "getLatestBlock":
 		b, err := w.eth.GetLatestBlock()
 		if err != nil {
-			log.Fatal("Eth failed to get latest: ", err)
+			return fmt.Errorf("Eth failed to get latest: %s", err)
 		}
 
-		log.Printf("%+v\n", b)
+		w.log.Infof("%+v", b)
 	case "getBlockNumberRaw":
-		ba, err := e.MakeRequestRaw(ethrpc.ETHBlockNumber)
+		ba, err := w.eth.MakeRequestRaw(ethrpc.ETHBlockNumber)
 
 		if err != nil {
-			log.Fatal("Eth failed to get block number raw: ", err)
+			return fmt.Errorf("Eth failed to get block number raw: %s", err)
 		}
 
-		log.Println(string(ba))
+		w.log.Infof("%s", ba)
 	case "getCode":
 		if len(args) < 2 {
-			log.Fatal("Missing address")
+			return fmt.Errorf("Missing address")
 		}
 		ba, err := w.eth.GetCode(args[1])
 		if err != nil {
-			log.Fatal("Eth failed to get block number: ", err)
+			return fmt.Errorf("Eth failed to get block number: %s", err)
 		}
 
-		log.Println("code", ba)
+		w.log.Infof("code %v", ba)
 	case "getUncleByBlockHashAndIndex":
 		if len(args) < 3 {
-			log.Fatal("Missing hash and or/index")
+			return fmt.Errorf("Missing hash and or/index")
 		}
 		b, err := w.eth.GetUncleByBlockHashAndIndex(args[1], args[2])
 		if err != nil {
-			log.Fatal("Eth failed to get block number: ", err)
+			return fmt.Errorf("Eth failed to get block number: %s", err)
 		}
 
-		log.Printf("%+v\n", b)
+		w.log.Infof("%+v", b)
 	case "traceBlock":
 		if len(args) < 2 {
-			log.Fatal("Missing hex block number and/or trace types")
+			return fmt.Errorf("Missing hex block number and/or trace types")
 		}
 		t, err := w.eth.TraceBlock(args[1])
 		if err != nil {
-			log.Fatal("Eth failed to trace block: ", err)
+			return fmt.Errorf("Eth failed to trace block: %s", err)
 		}
 
-		log.Printf("%+v\n", t)
+		w.log.Infof("%+v", t)
 	case "traceReplayBlockTransactions":
 		if len(args) < 3 {
-			log.Fatal("Missing hex block number")
+			return fmt.Errorf("Missing hex block number")
 		}
 		r, err := w.eth.TraceReplayBlockTransactions(args[1], args[2:]...)
 		if err != nil {
-			log.Fatal("Eth failed to replay block: ", err)
+			return fmt.Errorf("Eth failed to replay block: %s", err)
 		}
 
-		log.Printf("%+v\n", r)
+		w.log.Infof("%+v", r)
 	case "newBlockNumberSubscription":
-		blockNumbers, err := w.eth.NewBlockNumberSubscription()
+		sub, err := w.eth.SubscribeBlockNumber()
 		if err != nil {
-			log.Fatal("Eth failed to get block number subscription: ", err)
+			return fmt.Errorf("Eth failed to get block number subscription: %s", err)
 		}
 
+		go w.logErrors(sub.Subscription)
 		// the subscription closes when the connection dies
-		for number := range blockNumbers {
-			log.Println(*number)
+		for number := range sub.Numbers {
+			w.log.Infof("%d", *number)
 		}
-		log.Warnf("subscription died")
+		w.log.Warnf("subscription died")
 	case "newHeadsSubscription":
-		blockHeads, err := w.eth.NewHeadsSubscription()
+		sub, err := w.eth.SubscribeNewHeads()
 		if err != nil {
-			log.Fatal("Eth failed to get block number subscription: ", err)
+			return fmt.Errorf("Eth failed to get block number subscription: %s", err)
 		}
 
+		go w.logErrors(sub.Subscription)
 		// the subscription closes when the connection dies
-		for head := range blockHeads {
-			log.Printf("%+v\n", head)
+		for head := range sub.Heads {
+			w.log.Infof("%+v", head)
 		}
-		log.Warnf("subscription died")
+		w.log.Warnf("subscription died")
 	case "getBalance":
+		if len(args) < 3 {
+			return fmt.Errorf("Missing address and/or block number")
+		}
 		balance, err := w.eth.GetBalanceAtBlock(args[1], args[2])
 		if err != nil {
-			log.Fatal("Eth failed to get balance: ", err)
+			return fmt.Errorf("Eth failed to get balance: %s", err)
 		}
-		log.Println(balance)
+		w.log.Infof("%s", balance)
 	case "getTokenBalance":
+		if len(args) < 4 {
+			return fmt.Errorf("Missing address, token and/or block number")
+		}
 		balance, err := w.eth.GetTokenBalanceAtBlock(args[1], args[2], args[3])
 		if err != nil {
-			log.Fatal("Eth failed to get balance: ", err)
+			return fmt.Errorf("Eth failed to get balance: %s", err)
 		}
-		log.Println(balance)
+		w.log.Infof("%s", balance)
 	default:
-		log.Println("Command not implemented")
+		w.log.Infof("Command not implemented")
 	}
 
+	return nil
+}
+
+// logErrors logs the errors of a subscription, the last one is the cause of its end
+func (w *worker) logErrors(sub *ethrpc.Subscription) {
+	for err := range sub.Err() {
+		w.log.Warnf("subscription: %s", err)
+	}
 }
@@ -0,0 +1,604 @@
+// Package rpctest provides a json rpc server answering canned responses over http and
+// websockets, with fault injection to test the providers against a misbehaving node
+package rpctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// MethodNotFound is the json rpc error code of unknown methods
+const MethodNotFound = -32601
+
+// Error is a json rpc error object
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data,omitempty"`
+}
+
+// Request is a json rpc request received by the server
+type Request struct {
+	Version string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type notification struct {
+	Version string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result,omitempty"`
+		Error        *Error          `json:"error,omitempty"`
+	} `json:"params"`
+}
+
+type answer struct {
+	result json.RawMessage
+	err    *Error
+}
+
+type subscription struct {
+	id    string
+	event string
+	conn  *conn
+}
+
+// conn is a websocket or unix socket connection, writes are serialized
+type conn struct {
+	mu     sync.Mutex
+	encode func(v interface{}) error
+	close  func() error
+}
+
+func (c *conn) write(v interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.encode(v)
+}
+
+// Server is a json rpc server listening on a random local port. The same address
+// serves http posts and websocket upgrades, unix sockets can be added with ListenUnix.
+type Server struct {
+	// URL is the http address of the server
+	URL string
+	// WSURL is the websocket address of the server
+	WSURL string
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+	unix     []net.Listener
+
+	mu              sync.Mutex
+	answers         map[string]answer
+	requests        []*Request
+	headers         []http.Header
+	conns           map[*conn]bool
+	subscriptions   map[string]*subscription
+	nextID          int
+	latency         time.Duration
+	failures        []int
+	reverseBatches  bool
+	rejectBatches   *Error
+	batchLimit      int
+	truncateBatches int
+	dropAfterAnswer int
+}
+
+// NewServer starts a server without any canned response
+func NewServer() *Server {
+	s := &Server{
+		answers:       make(map[string]answer),
+		conns:         make(map[*conn]bool),
+		subscriptions: make(map[string]*subscription),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	s.WSURL = "ws" + strings.TrimPrefix(s.srv.URL, "http")
+	return s
+}
+
+// Close drops every connection and stops the server
+func (s *Server) Close() {
+	s.mu.Lock()
+	listeners := s.unix
+	s.unix = nil
+	s.mu.Unlock()
+	for _, l := range listeners {
+		l.Close()
+	}
+
+	s.DropConnections()
+	s.srv.Close()
+}
+
+// ListenUnix serves newline delimited json rpc on a unix socket at path, like the ipc of a node
+func (s *Server) ListenUnix(path string) error {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.unix = append(s.unix, l)
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			nc, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			c := &conn{encode: json.NewEncoder(nc).Encode, close: nc.Close}
+			dec := json.NewDecoder(nc)
+			go s.serveConn(c, func() ([]byte, error) {
+				var raw json.RawMessage
+				err := dec.Decode(&raw)
+				return raw, err
+			})
+		}
+	}()
+	return nil
+}
+
+// Handle answers result to every call of method whose params have no specific answer
+func (s *Server) Handle(method string, result interface{}) error {
+	return s.handle(method, nil, result, nil)
+}
+
+// HandleParams answers result to the calls of method with exactly these params
+func (s *Server) HandleParams(method string, params []interface{}, result interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	return s.handle(method, params, result, nil)
+}
+
+// HandleError answers a json rpc error to every call of method
+func (s *Server) HandleError(method string, code int, message string) error {
+	return s.handle(method, nil, nil, &Error{Code: code, Message: message})
+}
+
+func (s *Server) handle(method string, params []interface{}, result interface{}, rpcErr *Error) error {
+	var a answer
+	a.err = rpcErr
+	if rpcErr == nil {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		a.result = raw
+	}
+
+	k := method
+	if params != nil {
+		// going through json gives the same values as the decoded requests
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		var decoded []json.RawMessage
+		json.Unmarshal(raw, &decoded)
+		k = path(method, decoded)
+	}
+
+	s.mu.Lock()
+	s.answers[k] = a
+	s.mu.Unlock()
+	return nil
+}
+
+// LoadMock loads the responses of a directory in the testdata/mock layout:
+// <method>/<param>/.../response.json
+func (s *Server) LoadMock(dir string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "response.json" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		var resp response
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return fmt.Errorf("%s: %s", p, err)
+		}
+
+		rel, err := filepath.Rel(dir, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.answers[filepath.ToSlash(rel)] = answer{resp.Result, resp.Error}
+		s.mu.Unlock()
+		return nil
+	})
+}
+
+// SetLatency delays every answer by d
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	s.latency = d
+	s.mu.Unlock()
+}
+
+// FailNext makes the next http requests fail with the given statuses, one per
+// request. A 0 status closes the connection without answering.
+func (s *Server) FailNext(statuses ...int) {
+	s.mu.Lock()
+	s.failures = append(s.failures, statuses...)
+	s.mu.Unlock()
+}
+
+// ReverseBatches answers batches in the reverse order of the requests
+func (s *Server) ReverseBatches(reverse bool) {
+	s.mu.Lock()
+	s.reverseBatches = reverse
+	s.mu.Unlock()
+}
+
+// RejectBatches answers every batch with a single error object, like a node refusing
+// batches. A 0 code accepts batches again.
+func (s *Server) RejectBatches(code int, message string) {
+	s.mu.Lock()
+	s.rejectBatches = nil
+	if code != 0 {
+		s.rejectBatches = &Error{Code: code, Message: message}
+	}
+	s.mu.Unlock()
+}
+
+// SetBatchLimit answers the batches of more than n requests with a single "batch too large"
+// error, like geth. 0 removes the limit.
+func (s *Server) SetBatchLimit(n int) {
+	s.mu.Lock()
+	s.batchLimit = n
+	s.mu.Unlock()
+}
+
+// TruncateBatches answers only the first n requests of a batch, the other ones get no
+// response, like a node hitting its response size limit. 0 answers every request.
+func (s *Server) TruncateBatches(n int) {
+	s.mu.Lock()
+	s.truncateBatches = n
+	s.mu.Unlock()
+}
+
+// DropAfter closes a websocket connection after it received n more answers
+func (s *Server) DropAfter(n int) {
+	s.mu.Lock()
+	s.dropAfterAnswer = n
+	s.mu.Unlock()
+}
+
+// DropConnections closes every websocket connection, ending their subscriptions
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	var conns []*conn
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.close()
+	}
+}
+
+// Requests returns the requests received so far
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+// Headers returns the headers of the http requests and websocket handshakes received so far
+func (s *Server) Headers() []http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]http.Header(nil), s.headers...)
+}
+
+// Count returns how many times method was called
+func (s *Server) Count(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, r := range s.requests {
+		if r.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+// Subscriptions returns the number of active subscriptions to event
+func (s *Server) Subscriptions(event string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, sub := range s.subscriptions {
+		if sub.event == event {
+			n++
+		}
+	}
+	return n
+}
+
+// Notify sends result to every subscription to event, it returns the number of notifications sent
+func (s *Server) Notify(event string, result interface{}) (int, error) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return 0, err
+	}
+	return s.notify(event, raw, nil), nil
+}
+
+// NotifyError sends an error instead of a result to every subscription to event, like
+// nodes failing a subscription. It returns the number of notifications sent.
+func (s *Server) NotifyError(event string, code int, message string) int {
+	return s.notify(event, nil, &Error{Code: code, Message: message})
+}
+
+func (s *Server) notify(event string, raw json.RawMessage, rpcErr *Error) int {
+	s.mu.Lock()
+	var subs []*subscription
+	for _, sub := range s.subscriptions {
+		if sub.event == event {
+			subs = append(subs, sub)
+		}
+	}
+	s.mu.Unlock()
+
+	sent := 0
+	for _, sub := range subs {
+		var n notification
+		n.Version = "2.0"
+		n.Method = "eth_subscription"
+		n.Params.Subscription = sub.id
+		n.Params.Result = raw
+		n.Params.Error = rpcErr
+		if sub.conn.write(n) == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.headers = append(s.headers, r.Header)
+	s.mu.Unlock()
+
+	if websocket.IsWebSocketUpgrade(r) {
+		s.serveWS(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	status := -1
+	if len(s.failures) > 0 {
+		status = s.failures[0]
+		s.failures = s.failures[1:]
+	}
+	s.mu.Unlock()
+
+	switch {
+	case status == 0:
+		if hj, ok := w.(http.Hijacker); ok {
+			c, _, err := hj.Hijack()
+			if err == nil {
+				c.Close()
+				return
+			}
+		}
+		status = http.StatusInternalServerError
+		fallthrough
+	case status > 0:
+		w.WriteHeader(status)
+		fmt.Fprint(w, http.StatusText(status))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out, err := s.process(body, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	c := &conn{encode: ws.WriteJSON, close: ws.Close}
+	s.serveConn(c, func() ([]byte, error) {
+		_, message, err := ws.ReadMessage()
+		return message, err
+	})
+}
+
+// serveConn answers the messages of a connection until it is closed
+func (s *Server) serveConn(c *conn, read func() ([]byte, error)) {
+	s.mu.Lock()
+	s.conns[c] = true
+	s.mu.Unlock()
+
+	defer func() {
+		c.close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		for id, sub := range s.subscriptions {
+			if sub.conn == c {
+				delete(s.subscriptions, id)
+			}
+		}
+		s.mu.Unlock()
+	}()
+
+	for {
+		message, err := read()
+		if err != nil {
+			return
+		}
+
+		out, err := s.process(message, c)
+		if err != nil {
+			return
+		}
+		if err := c.write(out); err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		drop := false
+		if s.dropAfterAnswer > 0 {
+			s.dropAfterAnswer--
+			drop = s.dropAfterAnswer == 0
+		}
+		s.mu.Unlock()
+		if drop {
+			return
+		}
+	}
+}
+
+// process answers a single request or a batch
+func (s *Server) process(body []byte, c *conn) (interface{}, error) {
+	s.mu.Lock()
+	latency := s.latency
+	reverse := s.reverseBatches
+	reject := s.rejectBatches
+	limit := s.batchLimit
+	truncate := s.truncateBatches
+	s.mu.Unlock()
+	time.Sleep(latency)
+
+	trimmed := strings.TrimSpace(string(body))
+	if !strings.HasPrefix(trimmed, "[") {
+		var req Request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, err
+		}
+		return s.answer(&req, c), nil
+	}
+
+	var reqs []*Request
+	if err := json.Unmarshal(body, &reqs); err != nil {
+		return nil, err
+	}
+	if reject == nil && limit > 0 && len(reqs) > limit {
+		reject = &Error{Code: -32600, Message: "batch too large"}
+	}
+	if reject != nil {
+		return &response{Version: "2.0", ID: json.RawMessage("null"), Error: reject}, nil
+	}
+	out := make([]*response, len(reqs))
+	for i, req := range reqs {
+		out[i] = s.answer(req, c)
+	}
+	if truncate > 0 && len(out) > truncate {
+		out = out[:truncate]
+	}
+	if reverse {
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+	}
+	return out, nil
+}
+
+func (s *Server) answer(req *Request, c *conn) *response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, req)
+	resp := &response{Version: "2.0", ID: req.ID}
+
+	if strings.HasSuffix(req.Method, "_subscribe") && c != nil && len(req.Params) > 0 {
+		var event string
+		json.Unmarshal(req.Params[0], &event)
+		s.nextID++
+		id := fmt.Sprintf("0x%x", s.nextID)
+		s.subscriptions[id] = &subscription{id: id, event: event, conn: c}
+		resp.Result, _ = json.Marshal(id)
+		return resp
+	}
+	if strings.HasSuffix(req.Method, "_unsubscribe") && c != nil && len(req.Params) > 0 {
+		var id string
+		json.Unmarshal(req.Params[0], &id)
+		_, ok := s.subscriptions[id]
+		delete(s.subscriptions, id)
+		resp.Result, _ = json.Marshal(ok)
+		return resp
+	}
+
+	a, ok := s.answers[path(req.Method, req.Params)]
+	if !ok {
+		a, ok = s.answers[req.Method]
+	}
+	if !ok {
+		resp.Error = &Error{
+			Code:    MethodNotFound,
+			Message: fmt.Sprintf("The method %s does not exist/is not available", req.Method),
+		}
+		return resp
+	}
+
+	resp.Result = a.result
+	resp.Error = a.err
+	return resp
+}
+
+// path returns the key of a call in the testdata/mock layout, every param is a directory
+func path(method string, params []json.RawMessage) string {
+	segments := []string{method}
+	for _, raw := range params {
+		var v interface{}
+		json.Unmarshal(raw, &v)
+		segments = append(segments, fmt.Sprintf("%v", v))
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,57 @@
+package rpctest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func post(t *testing.T, url, body string) []map[string]interface{} {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var out []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestServer_LoadMock(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	assert.NoError(t, s.LoadMock("../testdata/mock"))
+
+	out := post(t, s.URL, `[
+		{"jsonrpc":"2.0","id":"1","method":"eth_blockNumber","params":[]},
+		{"jsonrpc":"2.0","id":"2","method":"trace_replayBlockTransactions","params":["0x2dc6c0",["vmTrace","trace","stateDiff"]]},
+		{"jsonrpc":"2.0","id":"3","method":"eth_getCode","params":["0x0","latest"]}
+	]`)
+
+	assert.Len(t, out, 3)
+	assert.Equal(t, "0x78bc12", out[0]["result"])
+	assert.NotNil(t, out[1]["result"])
+	assert.NotNil(t, out[2]["error"])
+	assert.Equal(t, 1, s.Count("eth_getCode"))
+}
+
+func TestServer_ReverseBatches(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.Handle("eth_blockNumber", "0x1")
+	s.ReverseBatches(true)
+
+	out := post(t, s.URL, `[
+		{"jsonrpc":"2.0","id":"1","method":"eth_blockNumber","params":[]},
+		{"jsonrpc":"2.0","id":"2","method":"eth_blockNumber","params":[]}
+	]`)
+
+	assert.Equal(t, "2", out[0]["id"])
+	assert.Equal(t, "1", out[1]["id"])
+}
@@ -0,0 +1,189 @@
+package transfers
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/alethio/web3-go/strhelper"
+	"github.com/alethio/web3-go/types"
+)
+
+// Kind describes the trace that produced a transfer
+type Kind string
+
+// transfer kinds
+const (
+	Call    Kind = "call"
+	Create  Kind = "create"
+	Suicide Kind = "suicide"
+	Reward  Kind = "reward"
+)
+
+// Transfer is a single movement of ether found in the traces
+type Transfer struct {
+	Kind Kind
+	// From is empty for rewards, the ether is minted
+	From  string
+	To    string
+	Value *big.Int
+	// RewardType is either "block" or "uncle", only set for rewards
+	RewardType string
+
+	BlockNumber         *int
+	TransactionHash     *string
+	TransactionPosition *int
+	TraceAddress        []int
+}
+
+// Internal returns true if the transfer was not the top level transaction value
+func (t Transfer) Internal() bool {
+	return t.Kind != Reward && len(t.TraceAddress) > 0
+}
+
+// Extract returns all the ether transfers found in the traces of a block, as returned by trace_block.
+// Subtraces of reverted calls are skipped since none of their transfers happened.
+func Extract(traces []types.Trace) ([]Transfer, error) {
+	forest, err := BuildForest(traces)
+	if err != nil {
+		return nil, err
+	}
+
+	return ExtractTree(forest...)
+}
+
+// ExtractReplays returns all the ether transfers found in the traces of trace_replayBlockTransactions
+func ExtractReplays(replays []types.TransactionReplay) ([]Transfer, error) {
+	var transfers []Transfer
+	for i, replay := range replays {
+		if len(replay.Trace) == 0 {
+			continue
+		}
+
+		root, err := BuildTree(replay.Trace)
+		if err != nil {
+			return nil, fmt.Errorf("replay at index %d: %s", i, err)
+		}
+
+		t, err := ExtractTree(root)
+		if err != nil {
+			return nil, fmt.Errorf("replay at index %d: %s", i, err)
+		}
+
+		// replayed traces carry no transaction info, take it from the replay itself
+		for j := range t {
+			if t[j].TransactionHash == nil {
+				t[j].TransactionHash = replay.TransactionHash
+			}
+			if t[j].TransactionPosition == nil {
+				position := i
+				t[j].TransactionPosition = &position
+			}
+		}
+		transfers = append(transfers, t...)
+	}
+
+	return transfers, nil
+}
+
+// ExtractTree walks the call trees depth first and returns the transfers in execution order
+func ExtractTree(roots ...*Node) ([]Transfer, error) {
+	var transfers []Transfer
+
+	var walk func(n *Node) error
+	walk = func(n *Node) error {
+		if n.Reverted() {
+			return nil
+		}
+
+		t, ok, err := fromTrace(n.Trace)
+		if err != nil {
+			return err
+		}
+		if ok {
+			transfers = append(transfers, t)
+		}
+
+		for _, c := range n.Children {
+			if err := walk(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, root := range roots {
+		if root == nil {
+			continue
+		}
+		if err := walk(root); err != nil {
+			return nil, err
+		}
+	}
+
+	return transfers, nil
+}
+
+// fromTrace returns the transfer done by a single trace, if any
+func fromTrace(trace *types.Trace) (Transfer, bool, error) {
+	t := Transfer{
+		BlockNumber:         trace.BlockNumber,
+		TransactionHash:     trace.TransactionHash,
+		TransactionPosition: trace.TransactionPosition,
+		TraceAddress:        trace.TraceAddress,
+	}
+	a := trace.Action
+
+	var value *string
+	switch trace.Type {
+	case "call":
+		// delegatecall and callcode run foreign code in the caller's context, no ether leaves it
+		if a.CallType != nil && (*a.CallType == "delegatecall" || *a.CallType == "callcode") {
+			return t, false, nil
+		}
+		t.Kind = Call
+		t.From = deref(a.From)
+		t.To = deref(a.To)
+		value = a.Value
+	case "create":
+		t.Kind = Create
+		t.From = deref(a.From)
+		if trace.Result != nil {
+			t.To = deref(trace.Result.Address)
+		}
+		value = a.Value
+	case "suicide":
+		t.Kind = Suicide
+		t.From = deref(a.Address)
+		t.To = deref(a.RefundAddress)
+		value = a.Balance
+	case "reward":
+		t.Kind = Reward
+		t.To = deref(a.Author)
+		t.RewardType = deref(a.RewardType)
+		value = a.Value
+	default:
+		return t, false, nil
+	}
+
+	if value == nil {
+		return t, false, nil
+	}
+
+	v, err := strhelper.HexStrToBigInt(*value)
+	if err != nil {
+		return t, false, fmt.Errorf("trace %s %v: %s", trace.Type, trace.TraceAddress, err)
+	}
+	if v.Sign() == 0 {
+		return t, false, nil
+	}
+	t.Value = v
+
+	return t, true, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,115 @@
+package transfers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/types"
+)
+
+func str(s string) *string { return &s }
+func num(i int) *int       { return &i }
+
+func TestExtract(t *testing.T) {
+	traces := []types.Trace{
+		{
+			Type:                "call",
+			Action:              types.TraceAction{CallType: str("call"), From: str("0xa"), To: str("0xb"), Value: str("0x10")},
+			TraceAddress:        []int{},
+			TransactionPosition: num(0),
+		},
+		{
+			Type:                "call",
+			Action:              types.TraceAction{CallType: str("delegatecall"), From: str("0xb"), To: str("0xc"), Value: str("0x10")},
+			TraceAddress:        []int{0},
+			TransactionPosition: num(0),
+		},
+		{
+			Type:                "call",
+			Action:              types.TraceAction{CallType: str("call"), From: str("0xb"), To: str("0xd"), Value: str("0x5")},
+			TraceAddress:        []int{1},
+			TransactionPosition: num(0),
+			Error:               str("Reverted"),
+		},
+		{
+			Type:                "call",
+			Action:              types.TraceAction{CallType: str("call"), From: str("0xd"), To: str("0xe"), Value: str("0x1")},
+			TraceAddress:        []int{1, 0},
+			TransactionPosition: num(0),
+		},
+		{
+			Type:                "create",
+			Action:              types.TraceAction{From: str("0xb"), Value: str("0x3")},
+			Result:              &types.TraceResult{Address: str("0xf")},
+			TraceAddress:        []int{2},
+			TransactionPosition: num(0),
+		},
+		{
+			Type:                "suicide",
+			Action:              types.TraceAction{Address: str("0xf"), Balance: str("0x3"), RefundAddress: str("0xa")},
+			TraceAddress:        []int{2, 0},
+			TransactionPosition: num(0),
+		},
+		{
+			Type:                "call",
+			Action:              types.TraceAction{CallType: str("call"), From: str("0xa"), To: str("0xb"), Value: str("0x0")},
+			TraceAddress:        []int{},
+			TransactionPosition: num(1),
+		},
+		{
+			Type:         "reward",
+			Action:       types.TraceAction{Author: str("0xm"), RewardType: str("block"), Value: str("0x2")},
+			TraceAddress: []int{},
+		},
+	}
+
+	transfers, err := Extract(traces)
+	assert.NoError(t, err)
+
+	var actual []string
+	for _, tr := range transfers {
+		actual = append(actual, string(tr.Kind)+" "+tr.From+"->"+tr.To+" "+tr.Value.String())
+	}
+	expected := []string{
+		"call 0xa->0xb 16",
+		"create 0xb->0xf 3",
+		"suicide 0xf->0xa 3",
+		"reward ->0xm 2",
+	}
+	assert.Equal(t, expected, actual)
+
+	assert.False(t, transfers[0].Internal())
+	assert.True(t, transfers[2].Internal())
+	assert.Equal(t, []int{2, 0}, transfers[2].TraceAddress)
+	assert.Equal(t, "block", transfers[3].RewardType)
+}
+
+func TestExtract_Block(t *testing.T) {
+	raw, err := ioutil.ReadFile("../testdata/web3_cache/trace_block/000007000062.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r types.RPCTraceBlock
+	if err := json.Unmarshal(raw, &r); err != nil {
+		t.Fatal(err)
+	}
+
+	transfers, err := Extract(r.Result)
+	assert.NoError(t, err)
+
+	rewards := 0
+	for _, tr := range transfers {
+		if tr.Kind == Reward {
+			rewards++
+			continue
+		}
+		assert.Equal(t, Call, tr.Kind)
+		assert.True(t, tr.Value.Sign() > 0)
+		// the only failed trace of the block is the [0 0] call of transaction 60
+		assert.False(t, *tr.TransactionPosition == 60 && len(tr.TraceAddress) == 2)
+	}
+	assert.Equal(t, 3, rewards)
+}
@@ -0,0 +1,98 @@
+package transfers
+
+import (
+	"fmt"
+
+	"github.com/alethio/web3-go/types"
+)
+
+// Node is a trace placed in the call tree of its transaction
+type Node struct {
+	Trace    *types.Trace
+	Children []*Node
+}
+
+// Reverted returns true if the trace failed, which discards every
+// state change made by it and by its children
+func (n *Node) Reverted() bool {
+	return n.Trace.Error != nil
+}
+
+// BuildTree arranges the flat list of traces of a single transaction into a call tree
+// using their TraceAddress. Traces are expected in the order returned by the client,
+// parents before children.
+func BuildTree(traces []types.Trace) (*Node, error) {
+	var root *Node
+	nodes := make(map[string]*Node, len(traces))
+
+	for i := range traces {
+		t := &traces[i]
+		n := &Node{Trace: t}
+
+		if len(t.TraceAddress) == 0 {
+			if root != nil {
+				return nil, fmt.Errorf("trace at index %d is a second root", i)
+			}
+			root = n
+		} else {
+			parent, ok := nodes[addressKey(t.TraceAddress[:len(t.TraceAddress)-1])]
+			if !ok {
+				return nil, fmt.Errorf("trace at index %d has no parent", i)
+			}
+			parent.Children = append(parent.Children, n)
+		}
+
+		nodes[addressKey(t.TraceAddress)] = n
+	}
+
+	return root, nil
+}
+
+// BuildForest splits the traces of a whole block (as returned by trace_block) by transaction
+// and builds a call tree for each of them. Traces that do not belong to a transaction,
+// like block and uncle rewards, are returned as single node trees, in order.
+func BuildForest(traces []types.Trace) ([]*Node, error) {
+	var forest []*Node
+	var group []types.Trace
+
+	flush := func() error {
+		if len(group) == 0 {
+			return nil
+		}
+		root, err := BuildTree(group)
+		if err != nil {
+			return err
+		}
+		forest = append(forest, root)
+		group = nil
+		return nil
+	}
+
+	for _, t := range traces {
+		if t.TransactionPosition == nil {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			reward := t
+			forest = append(forest, &Node{Trace: &reward})
+			continue
+		}
+
+		if len(group) > 0 && *group[0].TransactionPosition != *t.TransactionPosition {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		group = append(group, t)
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return forest, nil
+}
+
+func addressKey(address []int) string {
+	return fmt.Sprint(address)
+}
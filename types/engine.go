@@ -0,0 +1,88 @@
+package types
+
+// payload statuses of the engine api
+const (
+	PayloadValid            = "VALID"
+	PayloadInvalid          = "INVALID"
+	PayloadSyncing          = "SYNCING"
+	PayloadAccepted         = "ACCEPTED"
+	PayloadInvalidBlockHash = "INVALID_BLOCK_HASH"
+)
+
+// ExecutionPayload is the block exchanged between the consensus and execution clients.
+// Withdrawals come with V2, the blob gas fields with V3. Nil withdrawals are sent as null
+// for payloads before shanghai, an empty list is sent as an empty list.
+type ExecutionPayload struct {
+	ParentHash    string       `json:"parentHash"`
+	FeeRecipient  string       `json:"feeRecipient"`
+	StateRoot     string       `json:"stateRoot"`
+	ReceiptsRoot  string       `json:"receiptsRoot"`
+	LogsBloom     string       `json:"logsBloom"`
+	PrevRandao    string       `json:"prevRandao"`
+	BlockNumber   string       `json:"blockNumber"`
+	GasLimit      string       `json:"gasLimit"`
+	GasUsed       string       `json:"gasUsed"`
+	Timestamp     string       `json:"timestamp"`
+	ExtraData     string       `json:"extraData"`
+	BaseFeePerGas string       `json:"baseFeePerGas"`
+	BlockHash     string       `json:"blockHash"`
+	Transactions  []string     `json:"transactions"`
+	Withdrawals   []Withdrawal `json:"withdrawals"`
+	BlobGasUsed   string       `json:"blobGasUsed,omitempty"`
+	ExcessBlobGas string       `json:"excessBlobGas,omitempty"`
+}
+
+// Withdrawal is a withdrawal from the beacon chain
+type Withdrawal struct {
+	Index          string `json:"index"`
+	ValidatorIndex string `json:"validatorIndex"`
+	Address        string `json:"address"`
+	Amount         string `json:"amount"`
+}
+
+// PayloadStatus is the result of the validation of a payload
+type PayloadStatus struct {
+	Status          string `json:"status"`
+	LatestValidHash string `json:"latestValidHash"`
+	ValidationError string `json:"validationError"`
+}
+
+// ForkchoiceState is the head, safe and finalized blocks of the consensus client
+type ForkchoiceState struct {
+	HeadBlockHash      string `json:"headBlockHash"`
+	SafeBlockHash      string `json:"safeBlockHash"`
+	FinalizedBlockHash string `json:"finalizedBlockHash"`
+}
+
+// PayloadAttributes asks the execution client to build a payload on top of the new head.
+// Withdrawals come with V2, the parent beacon block root with V3. Withdrawals are null when
+// nil and an empty list when empty, like in ExecutionPayload.
+type PayloadAttributes struct {
+	Timestamp             string       `json:"timestamp"`
+	PrevRandao            string       `json:"prevRandao"`
+	SuggestedFeeRecipient string       `json:"suggestedFeeRecipient"`
+	Withdrawals           []Withdrawal `json:"withdrawals"`
+	ParentBeaconBlockRoot string       `json:"parentBeaconBlockRoot,omitempty"`
+}
+
+// ForkchoiceUpdatedResponse is the result of engine_forkchoiceUpdated, the payload id
+// is set when a payload is being built
+type ForkchoiceUpdatedResponse struct {
+	PayloadStatus PayloadStatus `json:"payloadStatus"`
+	PayloadID     string        `json:"payloadId"`
+}
+
+// BlobsBundle holds the blobs of the transactions of a payload
+type BlobsBundle struct {
+	Commitments []string `json:"commitments"`
+	Proofs      []string `json:"proofs"`
+	Blobs       []string `json:"blobs"`
+}
+
+// GetPayloadResponse is the result of engine_getPayloadV2 and later
+type GetPayloadResponse struct {
+	ExecutionPayload      ExecutionPayload `json:"executionPayload"`
+	BlockValue            string           `json:"blockValue"`
+	BlobsBundle           *BlobsBundle     `json:"blobsBundle,omitempty"`
+	ShouldOverrideBuilder bool             `json:"shouldOverrideBuilder"`
+}
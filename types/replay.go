@@ -14,15 +14,31 @@ type VMTrace struct {
 }
 
 type VMTraceOp struct {
-	Cost int `json:"cost"`
-	Ex   struct {
-		Mem   interface{} `json:"mem"`
-		Push  interface{} `json:"push"`
-		Store interface{} `json:"store"`
-		Used  int         `json:"used"`
-	} `json:"ex"`
-	Pc  int      `json:"pc"`
-	Sub *VMTrace `json:"sub"`
+	Cost int       `json:"cost"`
+	Ex   VMTraceEx `json:"ex"`
+	Pc   int       `json:"pc"`
+	Sub  *VMTrace  `json:"sub"`
+}
+
+// VMTraceEx holds the effects of executing an operation
+type VMTraceEx struct {
+	Mem   *VMTraceMem   `json:"mem"`
+	Push  []string      `json:"push"`
+	Store *VMTraceStore `json:"store"`
+	// Used is the gas left after the operation
+	Used int `json:"used"`
+}
+
+// VMTraceMem is a memory write of Data at offset Off
+type VMTraceMem struct {
+	Data string `json:"data"`
+	Off  int    `json:"off"`
+}
+
+// VMTraceStore is a storage write
+type VMTraceStore struct {
+	Key string `json:"key"`
+	Val string `json:"val"`
 }
 
 type RPCTraceReplayBlockTransactions struct {
@@ -0,0 +1,29 @@
+package types
+
+// StructLogTrace is the result of geth's debug_traceTransaction using the default struct logger
+type StructLogTrace struct {
+	Gas         int         `json:"gas"`
+	Failed      bool        `json:"failed"`
+	ReturnValue string      `json:"returnValue"`
+	StructLogs  []StructLog `json:"structLogs"`
+}
+
+// StructLog is the state of the vm before executing an operation
+type StructLog struct {
+	Pc      int               `json:"pc"`
+	Op      string            `json:"op"`
+	Gas     int               `json:"gas"`
+	GasCost int               `json:"gasCost"`
+	Depth   int               `json:"depth"`
+	Error   string            `json:"error,omitempty"`
+	Stack   []string          `json:"stack"`
+	Memory  []string          `json:"memory"`
+	Storage map[string]string `json:"storage"`
+	Refund  int               `json:"refund,omitempty"`
+}
+
+type RPCDebugTraceTransaction struct {
+	Jsonrpc string         `json:"jsonrpc"`
+	Result  StructLogTrace `json:"result"`
+	ID      int            `json:"id"`
+}
@@ -15,6 +15,9 @@ type TraceAction struct {
 	Address       *string `json:"address"`
 	Balance       *string `json:"balance"`
 	RefundAddress *string `json:"refundAddress"`
+	// reward
+	Author     *string `json:"author"`
+	RewardType *string `json:"rewardType"`
 }
 
 type TraceResult struct {
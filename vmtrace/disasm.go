@@ -0,0 +1,84 @@
+package vmtrace
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/alethio/web3-go/strhelper"
+)
+
+// Instruction is a single decoded instruction
+type Instruction struct {
+	Pc  int
+	Op  OpCode
+	Arg []byte
+}
+
+// String formats the instruction like "0x0a PUSH1 0x60"
+func (i Instruction) String() string {
+	if len(i.Arg) > 0 {
+		return fmt.Sprintf("0x%02x %s 0x%x", i.Pc, i.Op, i.Arg)
+	}
+	return fmt.Sprintf("0x%02x %s", i.Pc, i.Op)
+}
+
+// Program is disassembled bytecode which can be looked up by program counter
+type Program struct {
+	Instructions []Instruction
+	index        map[int]int
+}
+
+// Disassemble decodes hex encoded bytecode, like VMTrace.Code.
+// A PUSH truncated by the end of the code gets the available bytes as argument.
+func Disassemble(code string) (*Program, error) {
+	b, err := hex.DecodeString(strhelper.Trim0x(code))
+	if err != nil {
+		return nil, fmt.Errorf("disassemble: %s", err)
+	}
+
+	return DisassembleBytes(b), nil
+}
+
+// DisassembleBytes decodes raw bytecode
+func DisassembleBytes(code []byte) *Program {
+	p := &Program{index: make(map[int]int)}
+
+	for pc := 0; pc < len(code); pc++ {
+		op := OpCode(code[pc])
+		ins := Instruction{Pc: pc, Op: op}
+
+		if n := op.PushSize(); n > 0 {
+			end := pc + 1 + n
+			if end > len(code) {
+				end = len(code)
+			}
+			ins.Arg = code[pc+1 : end]
+			pc = end - 1
+		}
+
+		p.index[ins.Pc] = len(p.Instructions)
+		p.Instructions = append(p.Instructions, ins)
+	}
+
+	return p
+}
+
+// At returns the instruction starting at pc
+func (p *Program) At(pc int) (Instruction, bool) {
+	i, ok := p.index[pc]
+	if !ok {
+		return Instruction{}, false
+	}
+	return p.Instructions[i], true
+}
+
+// String returns the listing of the program, one instruction per line
+func (p *Program) String() string {
+	var sb strings.Builder
+	for _, ins := range p.Instructions {
+		sb.WriteString(ins.String())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
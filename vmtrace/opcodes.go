@@ -0,0 +1,206 @@
+package vmtrace
+
+import "fmt"
+
+// OpCode is a single EVM instruction byte
+type OpCode byte
+
+// opInfo describes the stack behaviour of an instruction
+type opInfo struct {
+	name string
+	pops int
+	push int
+}
+
+// a few opcodes needed by the analysis and the converters
+const (
+	STOP           OpCode = 0x00
+	CALLDATACOPY   OpCode = 0x37
+	CODECOPY       OpCode = 0x39
+	EXTCODECOPY    OpCode = 0x3c
+	RETURNDATACOPY OpCode = 0x3e
+	MSTORE         OpCode = 0x52
+	MSTORE8        OpCode = 0x53
+	SSTORE         OpCode = 0x55
+	MCOPY          OpCode = 0x5e
+	PUSH0          OpCode = 0x5f
+	PUSH1          OpCode = 0x60
+	PUSH32         OpCode = 0x7f
+	CREATE         OpCode = 0xf0
+	CALL           OpCode = 0xf1
+	CALLCODE       OpCode = 0xf2
+	RETURN         OpCode = 0xf3
+	DELEGATECALL   OpCode = 0xf4
+	CREATE2        OpCode = 0xf5
+	STATICCALL     OpCode = 0xfa
+	REVERT         OpCode = 0xfd
+	INVALID        OpCode = 0xfe
+	SELFDESTRUCT   OpCode = 0xff
+)
+
+var opTable = map[OpCode]opInfo{
+	0x00: {"STOP", 0, 0},
+	0x01: {"ADD", 2, 1},
+	0x02: {"MUL", 2, 1},
+	0x03: {"SUB", 2, 1},
+	0x04: {"DIV", 2, 1},
+	0x05: {"SDIV", 2, 1},
+	0x06: {"MOD", 2, 1},
+	0x07: {"SMOD", 2, 1},
+	0x08: {"ADDMOD", 3, 1},
+	0x09: {"MULMOD", 3, 1},
+	0x0a: {"EXP", 2, 1},
+	0x0b: {"SIGNEXTEND", 2, 1},
+
+	0x10: {"LT", 2, 1},
+	0x11: {"GT", 2, 1},
+	0x12: {"SLT", 2, 1},
+	0x13: {"SGT", 2, 1},
+	0x14: {"EQ", 2, 1},
+	0x15: {"ISZERO", 1, 1},
+	0x16: {"AND", 2, 1},
+	0x17: {"OR", 2, 1},
+	0x18: {"XOR", 2, 1},
+	0x19: {"NOT", 1, 1},
+	0x1a: {"BYTE", 2, 1},
+	0x1b: {"SHL", 2, 1},
+	0x1c: {"SHR", 2, 1},
+	0x1d: {"SAR", 2, 1},
+
+	0x20: {"SHA3", 2, 1},
+
+	0x30: {"ADDRESS", 0, 1},
+	0x31: {"BALANCE", 1, 1},
+	0x32: {"ORIGIN", 0, 1},
+	0x33: {"CALLER", 0, 1},
+	0x34: {"CALLVALUE", 0, 1},
+	0x35: {"CALLDATALOAD", 1, 1},
+	0x36: {"CALLDATASIZE", 0, 1},
+	0x37: {"CALLDATACOPY", 3, 0},
+	0x38: {"CODESIZE", 0, 1},
+	0x39: {"CODECOPY", 3, 0},
+	0x3a: {"GASPRICE", 0, 1},
+	0x3b: {"EXTCODESIZE", 1, 1},
+	0x3c: {"EXTCODECOPY", 4, 0},
+	0x3d: {"RETURNDATASIZE", 0, 1},
+	0x3e: {"RETURNDATACOPY", 3, 0},
+	0x3f: {"EXTCODEHASH", 1, 1},
+
+	0x40: {"BLOCKHASH", 1, 1},
+	0x41: {"COINBASE", 0, 1},
+	0x42: {"TIMESTAMP", 0, 1},
+	0x43: {"NUMBER", 0, 1},
+	0x44: {"DIFFICULTY", 0, 1},
+	0x45: {"GASLIMIT", 0, 1},
+	0x46: {"CHAINID", 0, 1},
+	0x47: {"SELFBALANCE", 0, 1},
+	0x48: {"BASEFEE", 0, 1},
+	0x49: {"BLOBHASH", 1, 1},
+	0x4a: {"BLOBBASEFEE", 0, 1},
+
+	0x50: {"POP", 1, 0},
+	0x51: {"MLOAD", 1, 1},
+	0x52: {"MSTORE", 2, 0},
+	0x53: {"MSTORE8", 2, 0},
+	0x54: {"SLOAD", 1, 1},
+	0x55: {"SSTORE", 2, 0},
+	0x56: {"JUMP", 1, 0},
+	0x57: {"JUMPI", 2, 0},
+	0x58: {"PC", 0, 1},
+	0x59: {"MSIZE", 0, 1},
+	0x5a: {"GAS", 0, 1},
+	0x5b: {"JUMPDEST", 0, 0},
+	0x5c: {"TLOAD", 1, 1},
+	0x5d: {"TSTORE", 2, 0},
+	0x5e: {"MCOPY", 3, 0},
+	0x5f: {"PUSH0", 0, 1},
+
+	0xa0: {"LOG0", 2, 0},
+	0xa1: {"LOG1", 3, 0},
+	0xa2: {"LOG2", 4, 0},
+	0xa3: {"LOG3", 5, 0},
+	0xa4: {"LOG4", 6, 0},
+
+	0xf0: {"CREATE", 3, 1},
+	0xf1: {"CALL", 7, 1},
+	0xf2: {"CALLCODE", 7, 1},
+	0xf3: {"RETURN", 2, 0},
+	0xf4: {"DELEGATECALL", 6, 1},
+	0xf5: {"CREATE2", 4, 1},
+	0xfa: {"STATICCALL", 6, 1},
+	0xfd: {"REVERT", 2, 0},
+	0xfe: {"INVALID", 0, 0},
+	0xff: {"SELFDESTRUCT", 1, 0},
+}
+
+var opByName = make(map[string]OpCode)
+
+func init() {
+	for i := 0; i < 32; i++ {
+		opTable[PUSH1+OpCode(i)] = opInfo{fmt.Sprintf("PUSH%d", i+1), 0, 1}
+	}
+	for i := 0; i < 16; i++ {
+		opTable[OpCode(0x80+i)] = opInfo{fmt.Sprintf("DUP%d", i+1), i + 1, i + 2}
+		opTable[OpCode(0x90+i)] = opInfo{fmt.Sprintf("SWAP%d", i+1), i + 2, i + 2}
+	}
+
+	for op, info := range opTable {
+		opByName[info.name] = op
+	}
+	// names used by clients of other eras for the same instructions
+	opByName["SUICIDE"] = SELFDESTRUCT
+	opByName["KECCAK256"] = opByName["SHA3"]
+	opByName["PREVRANDAO"] = opByName["DIFFICULTY"]
+}
+
+// String returns the mnemonic of the opcode
+func (op OpCode) String() string {
+	if info, ok := opTable[op]; ok {
+		return info.name
+	}
+	return fmt.Sprintf("opcode 0x%02x not defined", byte(op))
+}
+
+// IsDefined returns true for known opcodes
+func (op OpCode) IsDefined() bool {
+	_, ok := opTable[op]
+	return ok
+}
+
+// IsPush returns true for PUSH1 to PUSH32
+func (op OpCode) IsPush() bool {
+	return op >= PUSH1 && op <= PUSH32
+}
+
+// PushSize returns the number of immediate bytes following a PUSH instruction
+func (op OpCode) PushSize() int {
+	if !op.IsPush() {
+		return 0
+	}
+	return int(op-PUSH1) + 1
+}
+
+// StackPops returns the number of stack items consumed by the instruction
+func (op OpCode) StackPops() int {
+	return opTable[op].pops
+}
+
+// StackPushes returns the number of stack items produced by the instruction
+func (op OpCode) StackPushes() int {
+	return opTable[op].push
+}
+
+// IsCall returns true for instructions starting a new call frame
+func (op OpCode) IsCall() bool {
+	switch op {
+	case CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE, CREATE2:
+		return true
+	}
+	return false
+}
+
+// OpCodeByName returns the opcode with the given mnemonic
+func OpCodeByName(name string) (OpCode, bool) {
+	op, ok := opByName[name]
+	return op, ok
+}
@@ -0,0 +1,237 @@
+package vmtrace
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/alethio/web3-go/types"
+)
+
+// Stat aggregates the executions of something
+type Stat struct {
+	Count int64
+	Gas   int64
+}
+
+func (s *Stat) add(gas int64) {
+	s.Count++
+	s.Gas += gas
+}
+
+// Location is a program counter inside a contract
+type Location struct {
+	Contract string
+	Pc       int
+}
+
+// HotSpot is a location together with its cost
+type HotSpot struct {
+	Location
+	Op OpCode
+	Stat
+}
+
+// Profile is the gas spent by one or more vm traces.
+// Gas of call and create operations only counts the operation itself, the gas spent
+// by the called code is attributed to the sub trace.
+type Profile struct {
+	ByOpcode   map[OpCode]*Stat
+	ByContract map[string]*Stat
+	ByPC       map[Location]*Stat
+
+	ops    map[Location]OpCode
+	stacks map[string]int64
+	code   map[string]*Program
+}
+
+// NewProfile returns an empty profile
+func NewProfile() *Profile {
+	return &Profile{
+		ByOpcode:   make(map[OpCode]*Stat),
+		ByContract: make(map[string]*Stat),
+		ByPC:       make(map[Location]*Stat),
+		ops:        make(map[Location]OpCode),
+		stacks:     make(map[string]int64),
+		code:       make(map[string]*Program),
+	}
+}
+
+// Analyze profiles the vm trace of a replayed transaction. The replay must have been made
+// with both "vmTrace" and "trace" so contracts can be named by address; without the
+// call traces contracts are named by their position in the call tree.
+func Analyze(replay types.TransactionReplay) (*Profile, error) {
+	p := NewProfile()
+	err := p.AddReplay(replay)
+	return p, err
+}
+
+// AddReplay adds the vm trace of a replayed transaction to the profile
+func (p *Profile) AddReplay(replay types.TransactionReplay) error {
+	if replay.VMTrace == nil {
+		return fmt.Errorf("replay has no vmTrace")
+	}
+
+	traces := make(map[string]*types.Trace, len(replay.Trace))
+	for i := range replay.Trace {
+		traces[fmt.Sprint(replay.Trace[i].TraceAddress)] = &replay.Trace[i]
+	}
+
+	name := func(address []int) string {
+		if t, ok := traces[fmt.Sprint(address)]; ok {
+			if t.Type == "create" && t.Result != nil && t.Result.Address != nil {
+				return *t.Result.Address
+			}
+			if t.Action.To != nil {
+				return *t.Action.To
+			}
+		}
+		return positionName(address)
+	}
+
+	return p.add(replay.VMTrace, []int{}, nil, name)
+}
+
+// AddTrace adds a vm trace to the profile naming the contracts by their position in the call tree
+func (p *Profile) AddTrace(trace *types.VMTrace) error {
+	return p.add(trace, []int{}, nil, positionName)
+}
+
+func positionName(address []int) string {
+	s := make([]string, 0, len(address)+1)
+	s = append(s, "root")
+	for _, a := range address {
+		s = append(s, fmt.Sprint(a))
+	}
+	return strings.Join(s, "/")
+}
+
+// add walks a trace and its subtraces
+func (p *Profile) add(trace *types.VMTrace, address []int, stack []string, name func([]int) string) error {
+	contract := name(address)
+	stack = append(stack[:len(stack):len(stack)], contract)
+
+	program, err := p.program(trace.Code)
+	if err != nil {
+		return err
+	}
+
+	sub := 0
+	for i, op := range trace.Ops {
+		gas := int64(op.Cost)
+		if op.Sub != nil {
+			// the cost of a call includes the gas handed over to the callee, the gas left
+			// after the call tells how much was really spent
+			if i > 0 {
+				gas = int64(trace.Ops[i-1].Ex.Used - op.Ex.Used)
+			}
+			gas -= spent(op.Sub)
+			if gas < 0 {
+				gas = 0
+			}
+		}
+
+		code := INVALID
+		if ins, ok := program.At(op.Pc); ok {
+			code = ins.Op
+		}
+		loc := Location{Contract: contract, Pc: op.Pc}
+
+		if _, ok := p.ByOpcode[code]; !ok {
+			p.ByOpcode[code] = &Stat{}
+		}
+		p.ByOpcode[code].add(gas)
+		if _, ok := p.ByContract[contract]; !ok {
+			p.ByContract[contract] = &Stat{}
+		}
+		p.ByContract[contract].add(gas)
+		if _, ok := p.ByPC[loc]; !ok {
+			p.ByPC[loc] = &Stat{}
+		}
+		p.ByPC[loc].add(gas)
+		p.ops[loc] = code
+		p.stacks[strings.Join(append(stack, code.String()), ";")] += gas
+
+		if op.Sub != nil {
+			subAddress := append(address[:len(address):len(address)], sub)
+			sub++
+			if err := p.add(op.Sub, subAddress, stack, name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *Profile) program(code string) (*Program, error) {
+	if program, ok := p.code[code]; ok {
+		return program, nil
+	}
+	program, err := Disassemble(code)
+	if err != nil {
+		return nil, err
+	}
+	p.code[code] = program
+	return program, nil
+}
+
+// spent returns the gas used by a trace including its subtraces
+func spent(trace *types.VMTrace) int64 {
+	if len(trace.Ops) == 0 {
+		return 0
+	}
+	first := trace.Ops[0]
+	last := trace.Ops[len(trace.Ops)-1]
+	return int64(first.Ex.Used + first.Cost - last.Ex.Used)
+}
+
+// Gas returns the total gas of the profile
+func (p *Profile) Gas() int64 {
+	var total int64
+	for _, s := range p.ByContract {
+		total += s.Gas
+	}
+	return total
+}
+
+// HotSpots returns the n most expensive locations, all of them if n is 0
+func (p *Profile) HotSpots(n int) []HotSpot {
+	spots := make([]HotSpot, 0, len(p.ByPC))
+	for loc, s := range p.ByPC {
+		spots = append(spots, HotSpot{Location: loc, Op: p.ops[loc], Stat: *s})
+	}
+
+	sort.Slice(spots, func(i, j int) bool {
+		if spots[i].Gas != spots[j].Gas {
+			return spots[i].Gas > spots[j].Gas
+		}
+		if spots[i].Contract != spots[j].Contract {
+			return spots[i].Contract < spots[j].Contract
+		}
+		return spots[i].Pc < spots[j].Pc
+	})
+
+	if n > 0 && n < len(spots) {
+		spots = spots[:n]
+	}
+	return spots
+}
+
+// WriteCollapsed writes the profile in the collapsed stack format used by flame graph tools,
+// one "contract;subcontract;OPCODE gas" line per distinct stack
+func (p *Profile) WriteCollapsed(w io.Writer) error {
+	stacks := make([]string, 0, len(p.stacks))
+	for s := range p.stacks {
+		stacks = append(stacks, s)
+	}
+	sort.Strings(stacks)
+
+	for _, s := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", s, p.stacks[s]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
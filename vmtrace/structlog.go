@@ -0,0 +1,233 @@
+package vmtrace
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/alethio/web3-go/strhelper"
+	"github.com/alethio/web3-go/types"
+)
+
+// FromStructLogs converts the struct logs of geth's debug_traceTransaction into a VMTrace
+// like the one returned by parity's trace_replayTransaction.
+//
+// Struct logs do not contain the executed code, so the code of every trace is rebuilt from
+// the executed instructions; bytes which were never executed are left zero. Memory writes
+// are only filled in when the logs were made with memory enabled.
+func FromStructLogs(logs []types.StructLog) (*types.VMTrace, error) {
+	if len(logs) == 0 {
+		return &types.VMTrace{Code: "0x", Ops: []types.VMTraceOp{}}, nil
+	}
+
+	c := &converter{logs: logs}
+	trace, err := c.frame(logs[0].Depth)
+	if err != nil {
+		return nil, err
+	}
+	if c.pos != len(logs) {
+		return nil, fmt.Errorf("struct log %d: unexpected depth %d", c.pos, logs[c.pos].Depth)
+	}
+
+	return trace, nil
+}
+
+type converter struct {
+	logs []types.StructLog
+	pos  int
+}
+
+// frame converts the logs of a single call frame, starting at the current position
+func (c *converter) frame(depth int) (*types.VMTrace, error) {
+	trace := &types.VMTrace{Ops: []types.VMTraceOp{}}
+	var code []byte
+
+	for c.pos < len(c.logs) {
+		log := c.logs[c.pos]
+		if log.Depth < depth {
+			break
+		}
+		if log.Depth > depth {
+			return nil, fmt.Errorf("struct log %d: unexpected depth %d", c.pos, log.Depth)
+		}
+
+		op, ok := OpCodeByName(log.Op)
+		if !ok {
+			// newer geth versions print undefined opcodes like "opcode 0xef not defined"
+			op = INVALID
+		}
+		c.pos++
+
+		var sub *types.VMTrace
+		if c.pos < len(c.logs) && c.logs[c.pos].Depth > depth {
+			var err error
+			sub, err = c.frame(c.logs[c.pos].Depth)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// the state before the next operation of this frame is the state after this one
+		var next *types.StructLog
+		if c.pos < len(c.logs) && c.logs[c.pos].Depth == depth {
+			next = &c.logs[c.pos]
+		}
+
+		vmOp, err := convertOp(log, next, op)
+		if err != nil {
+			return nil, fmt.Errorf("struct log %d: %s", c.pos-1, err)
+		}
+		vmOp.Sub = sub
+		trace.Ops = append(trace.Ops, vmOp)
+
+		code = setCode(code, log.Pc, op, vmOp.Ex.Push)
+	}
+
+	trace.Code = "0x" + hex.EncodeToString(code)
+	return trace, nil
+}
+
+func convertOp(log types.StructLog, next *types.StructLog, op OpCode) (types.VMTraceOp, error) {
+	vmOp := types.VMTraceOp{
+		Cost: log.GasCost,
+		Pc:   log.Pc,
+		Ex: types.VMTraceEx{
+			Push: []string{},
+			Used: log.Gas - log.GasCost,
+		},
+	}
+
+	if next == nil {
+		return vmOp, nil
+	}
+	vmOp.Ex.Used = next.Gas
+
+	if n := op.StackPushes(); n > 0 && n <= len(next.Stack) {
+		for _, s := range next.Stack[len(next.Stack)-n:] {
+			v, err := normalize(s)
+			if err != nil {
+				return vmOp, err
+			}
+			vmOp.Ex.Push = append(vmOp.Ex.Push, v)
+		}
+	}
+
+	stack := func(i int) (*big.Int, error) {
+		if i >= len(log.Stack) {
+			return nil, fmt.Errorf("%s: stack underflow", log.Op)
+		}
+		return strhelper.HexStrToBigInt(log.Stack[len(log.Stack)-1-i])
+	}
+
+	switch op {
+	case SSTORE:
+		key, err := stack(0)
+		if err != nil {
+			return vmOp, err
+		}
+		val, err := stack(1)
+		if err != nil {
+			return vmOp, err
+		}
+		vmOp.Ex.Store = &types.VMTraceStore{
+			Key: fmt.Sprintf("0x%x", key),
+			Val: fmt.Sprintf("0x%x", val),
+		}
+	case MSTORE, MSTORE8:
+		if len(next.Memory) == 0 {
+			break
+		}
+		off, err := stack(0)
+		if err != nil {
+			return vmOp, err
+		}
+		size := 32
+		if op == MSTORE8 {
+			size = 1
+		}
+		vmOp.Ex.Mem, err = memory(next.Memory, off, big.NewInt(int64(size)))
+		if err != nil {
+			return vmOp, err
+		}
+	default:
+		// copies to memory: the destination and the size are at fixed stack positions
+		dst, size := -1, -1
+		switch op {
+		case CALLDATACOPY, CODECOPY, RETURNDATACOPY, MCOPY:
+			dst, size = 0, 2
+		case EXTCODECOPY:
+			dst, size = 1, 3
+		}
+		if dst < 0 || len(next.Memory) == 0 {
+			break
+		}
+		off, err := stack(dst)
+		if err != nil {
+			return vmOp, err
+		}
+		n, err := stack(size)
+		if err != nil {
+			return vmOp, err
+		}
+		vmOp.Ex.Mem, err = memory(next.Memory, off, n)
+		if err != nil {
+			return vmOp, err
+		}
+	}
+
+	return vmOp, nil
+}
+
+// memory returns the written slice of the memory words logged by geth
+func memory(words []string, off, size *big.Int) (*types.VMTraceMem, error) {
+	if size.Sign() == 0 {
+		return nil, nil
+	}
+
+	mem, err := hex.DecodeString(strhelper.Trim0x(strings.Join(words, "")))
+	if err != nil {
+		return nil, fmt.Errorf("memory: %s", err)
+	}
+
+	end := new(big.Int).Add(off, size)
+	if !end.IsInt64() || end.Int64() > int64(len(mem)) {
+		// the logged memory is incomplete, nothing to report
+		return nil, nil
+	}
+
+	return &types.VMTraceMem{
+		Data: "0x" + hex.EncodeToString(mem[off.Int64():end.Int64()]),
+		Off:  int(off.Int64()),
+	}, nil
+}
+
+// setCode places an executed instruction into the rebuilt code
+func setCode(code []byte, pc int, op OpCode, push []string) []byte {
+	end := pc + 1 + op.PushSize()
+	if end > len(code) {
+		code = append(code, make([]byte, end-len(code))...)
+	}
+	code[pc] = byte(op)
+
+	if op.IsPush() && len(push) == 1 {
+		v, err := strhelper.HexStrToBigInt(push[0])
+		if err == nil {
+			b := v.Bytes()
+			if len(b) <= op.PushSize() {
+				copy(code[end-len(b):end], b)
+			}
+		}
+	}
+
+	return code
+}
+
+// normalize turns both padded and short hex stack items into the short form used by parity
+func normalize(s string) (string, error) {
+	v, err := strhelper.HexStrToBigInt(s)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("0x%x", v), nil
+}
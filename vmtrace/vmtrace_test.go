@@ -0,0 +1,132 @@
+package vmtrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/alethio/web3-go/types"
+)
+
+func TestDisassemble(t *testing.T) {
+	p, err := Disassemble("0x60606040526000ff61ab")
+	assert.NoError(t, err)
+
+	expected := "0x00 PUSH1 0x60\n0x02 PUSH1 0x40\n0x04 MSTORE\n0x05 PUSH1 0x00\n0x07 SELFDESTRUCT\n0x08 PUSH2 0xab\n"
+	assert.Equal(t, expected, p.String())
+
+	ins, ok := p.At(4)
+	assert.True(t, ok)
+	assert.Equal(t, MSTORE, ins.Op)
+
+	_, ok = p.At(1)
+	assert.False(t, ok)
+}
+
+func TestAnalyze(t *testing.T) {
+	raw, err := ioutil.ReadFile("../testdata/TraceReplayBlockTransactions_0x2dc6c0.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var replays []types.TransactionReplay
+	if err := json.Unmarshal(raw, &replays); err != nil {
+		t.Fatal(err)
+	}
+
+	replay := replays[0]
+	p, err := Analyze(replay)
+	assert.NoError(t, err)
+
+	var cost int64
+	for _, op := range replay.VMTrace.Ops {
+		cost += int64(op.Cost)
+	}
+	assert.Equal(t, cost, p.Gas())
+	var count int64
+	for _, s := range p.ByOpcode {
+		count += s.Count
+	}
+	assert.Equal(t, int64(len(replay.VMTrace.Ops)), count)
+
+	// contract creation, the contract is named after the created address
+	assert.Len(t, p.ByContract, 1)
+	assert.NotNil(t, p.ByContract[*replay.Trace[0].Result.Address])
+
+	spots := p.HotSpots(3)
+	assert.Len(t, spots, 3)
+	assert.True(t, spots[0].Gas >= spots[1].Gas)
+
+	var buf bytes.Buffer
+	assert.NoError(t, p.WriteCollapsed(&buf))
+	assert.Contains(t, buf.String(), *replay.Trace[0].Result.Address+";CODECOPY 78\n")
+}
+
+func TestAnalyze_Sub(t *testing.T) {
+	trace := &types.VMTrace{
+		Code: "0x6000f100",
+		Ops: []types.VMTraceOp{
+			{Cost: 3, Pc: 0, Ex: types.VMTraceEx{Used: 997}},
+			{Cost: 700 + 500, Pc: 2, Ex: types.VMTraceEx{Used: 897}, Sub: &types.VMTrace{
+				Code: "0x600000",
+				Ops: []types.VMTraceOp{
+					{Cost: 3, Pc: 0, Ex: types.VMTraceEx{Used: 497}},
+					{Cost: 0, Pc: 2, Ex: types.VMTraceEx{Used: 497}},
+				},
+			}},
+			{Cost: 0, Pc: 3, Ex: types.VMTraceEx{Used: 897}},
+		},
+	}
+
+	p := NewProfile()
+	assert.NoError(t, p.AddTrace(trace))
+
+	// the call spent 100 gas of which 3 were used by the callee
+	assert.Equal(t, int64(97), p.ByOpcode[CALL].Gas)
+	assert.Equal(t, int64(3), p.ByContract["root/0"].Gas)
+	assert.Equal(t, int64(100), p.ByContract["root"].Gas)
+
+	var buf bytes.Buffer
+	assert.NoError(t, p.WriteCollapsed(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, []string{"root;CALL 97", "root;PUSH1 3", "root;STOP 0", "root;root/0;PUSH1 3", "root;root/0;STOP 0"}, lines)
+}
+
+func TestFromStructLogs(t *testing.T) {
+	word := func(b string) string { return strings.Repeat("0", 64-len(b)) + b }
+	logs := []types.StructLog{
+		{Pc: 0, Op: "PUSH1", Gas: 1000, GasCost: 3, Depth: 1, Stack: []string{}},
+		{Pc: 2, Op: "PUSH1", Gas: 997, GasCost: 3, Depth: 1, Stack: []string{"0x60"}},
+		{Pc: 4, Op: "MSTORE", Gas: 994, GasCost: 12, Depth: 1, Stack: []string{"0x60", "0x40"}},
+		{Pc: 5, Op: "CALL", Gas: 982, GasCost: 500, Depth: 1, Stack: []string{"0x0", "0x0", "0x0", "0x0", "0x0", "0xb", "0x1f4"}, Memory: []string{word(""), word(""), word("60")}},
+		{Pc: 0, Op: "PUSH1", Gas: 500, GasCost: 3, Depth: 2, Stack: []string{}},
+		{Pc: 2, Op: "STOP", Gas: 497, GasCost: 0, Depth: 2, Stack: []string{"0x1"}},
+		{Pc: 6, Op: "SSTORE", Gas: 979, GasCost: 5000, Depth: 1, Stack: []string{"0x1", word("2a"), word("1")}},
+		{Pc: 7, Op: "STOP", Gas: 0, GasCost: 0, Depth: 1, Stack: []string{"0x1"}},
+	}
+
+	trace, err := FromStructLogs(logs)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "0x6060604052f15500", trace.Code)
+	assert.Len(t, trace.Ops, 6)
+	assert.Equal(t, []string{"0x60"}, trace.Ops[0].Ex.Push)
+	assert.Equal(t, 997, trace.Ops[0].Ex.Used)
+	assert.Equal(t, &types.VMTraceMem{Data: "0x" + word("60"), Off: 0x40}, trace.Ops[2].Ex.Mem)
+	assert.Equal(t, []string{"0x1"}, trace.Ops[3].Ex.Push)
+	assert.Equal(t, &types.VMTraceStore{Key: "0x1", Val: "0x2a"}, trace.Ops[4].Ex.Store)
+
+	sub := trace.Ops[3].Sub
+	if assert.NotNil(t, sub) {
+		assert.Equal(t, "0x600100", sub.Code)
+		assert.Len(t, sub.Ops, 2)
+	}
+
+	p := NewProfile()
+	assert.NoError(t, p.AddTrace(trace))
+	assert.Equal(t, int64(3), p.ByContract["root/0"].Gas)
+	assert.Equal(t, int64(5000), p.ByOpcode[SSTORE].Gas)
+}